@@ -0,0 +1,125 @@
+package event
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultIdleTimeout = time.Second
+
+// Autoscale 每个队列的弹性worker配置. 固定的worker照常执行队列中所有事件, 非HashExec事件积压或等待过久时
+// 再启动额外的worker分担, 它们只取非HashExec事件, 空闲IdleTimeout后退出, 所以同key顺序不受影响.
+// BatchHandle 非nil时不生效
+type Autoscale struct {
+	MaxWorkers  int           //每个队列的worker上限(含固定的一个), <=1 不扩容
+	MaxWait     time.Duration //取出的事件等待超过该值且还有非HashExec事件积压时扩容, <=0 不按等待时间扩容
+	MaxBacklog  int           //队列中非HashExec事件达到该数量时扩容, <=0 不按积压扩容
+	IdleTimeout time.Duration //扩出的worker空闲多久后退出, <=0 取1s
+	OnScale     ScaleHook     //每次调整前调用, 返回false时放弃这次调整
+}
+
+// ScaleReason ...
+type ScaleReason int
+
+const (
+	ScaleUpWait    ScaleReason = iota //事件等待超过MaxWait
+	ScaleUpBacklog                    //积压达到MaxBacklog
+	ScaleDownIdle                     //扩出的worker空闲超过IdleTimeout
+)
+
+func (r ScaleReason) String() string {
+	switch r {
+	case ScaleUpWait:
+		return "wait"
+	case ScaleUpBacklog:
+		return "backlog"
+	case ScaleDownIdle:
+		return "idle"
+	}
+	return fmt.Sprintf("ScaleReason(%d)", int(r))
+}
+
+// ScaleHook decides a scaling of the queue, workers is the count after the change
+type ScaleHook func(queueIndex, workers int, reason ScaleReason) bool
+
+// ScaleObserver is an optional interface of Observer to be told about every change of the worker count of a queue
+type ScaleObserver interface {
+	OnScale(name string, queueIndex, workers int, reason ScaleReason)
+}
+
+// autoscaled ...
+func (c *Ctrl) autoscaled() bool {
+	return c.Autoscale != nil && c.Autoscale.MaxWorkers > 1 && c.BatchHandle == nil
+}
+
+// scaleUp 满足reason的条件时为q增加一个worker
+func (c *Ctrl) scaleUp(q *queue, reason ScaleReason) {
+	a := c.Autoscale
+	backlog := 1
+	if reason == ScaleUpBacklog {
+		backlog = a.MaxBacklog
+	}
+	workers, ok := q.grow(a.MaxWorkers, backlog)
+	if !ok {
+		return
+	}
+	if a.OnScale != nil && !a.OnScale(q.index, workers, reason) {
+		q.shrink()
+		q.elastic.Done()
+		return
+	}
+	c.scaled(q, workers, reason)
+	go c.runElastic(q)
+}
+
+// scaleDown 扩出的worker空闲时调用, 返回true表示该worker应该退出
+func (c *Ctrl) scaleDown(q *queue) bool {
+	a := c.Autoscale
+	if a.OnScale != nil && !a.OnScale(q.index, q.workerCount()-1, ScaleDownIdle) {
+		return false
+	}
+	c.scaled(q, q.shrink(), ScaleDownIdle)
+	return true
+}
+
+func (c *Ctrl) scaled(q *queue, workers int, reason ScaleReason) {
+	if o, ok := c.Observer.(ScaleObserver); ok {
+		o.OnScale(c.Name, q.index, workers, reason)
+	}
+}
+
+// runElastic 扩出的worker, 只执行非HashExec事件
+func (c *Ctrl) runElastic(q *queue) {
+	defer q.elastic.Done()
+	idle := c.Autoscale.IdleTimeout
+	if idle <= 0 {
+		idle = defaultIdleTimeout
+	}
+	for {
+		e, ok, timeout := q.popUnkeyed(idle)
+		if !ok {
+			q.shrink()
+			return
+		}
+		if timeout {
+			if c.scaleDown(q) {
+				return
+			}
+			continue
+		}
+		c.execute(q, e)
+	}
+}
+
+// Workers returns the number of workers of the queue, the ones started by Autoscale included
+func (c *Ctrl) Workers(queueIndex int) int {
+	c.putMu.RLock()
+	isRun := c.isRun
+	c.putMu.RUnlock()
+	c.queueMu.RLock()
+	defer c.queueMu.RUnlock()
+	if !isRun || queueIndex < 0 || queueIndex >= len(c.queues) {
+		return 0
+	}
+	return c.queues[queueIndex].workerCount()
+}
@@ -0,0 +1,128 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitWorkers 轮询直到队列i的worker数为want或超时, 返回最后看到的worker数
+func waitWorkers(ctrl *Ctrl, i, want int) int {
+	deadline := time.Now().Add(time.Second)
+	for ctrl.Workers(i) != want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return ctrl.Workers(i)
+}
+
+func TestAutoscaleBacklog(t *testing.T) {
+	ctrl := NewCtrl("autoscale", 1, 64, DefaultHash)
+	var mu sync.Mutex
+	var reasons []ScaleReason
+	ctrl.Autoscale = &Autoscale{
+		MaxWorkers:  4,
+		MaxBacklog:  2,
+		IdleTimeout: 20 * time.Millisecond,
+		OnScale: func(queueIndex, workers int, reason ScaleReason) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			reasons = append(reasons, reason)
+			return true
+		},
+	}
+	ctrl.Run()
+	release := make(chan struct{})
+	var running, maxRunning int64
+	var order []int
+	for i := 0; i < 8; i++ {
+		ctrl.EventPut(NewData("", i, func(data any) error {
+			n := atomic.AddInt64(&running, 1)
+			defer atomic.AddInt64(&running, -1)
+			mu.Lock()
+			if n > maxRunning {
+				maxRunning = n
+			}
+			mu.Unlock()
+			<-release
+			return nil
+		}), RRExec)
+		ctrl.EventPut(NewData("k", i, func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, data.(int))
+			return nil
+		}), HashExec)
+	}
+	if n := waitWorkers(ctrl, 0, 4); n != 4 {
+		t.Errorf("Workers() under backlog = %d, want 4", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&running) < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	ctrl.Drain(context.Background())
+	if n := waitWorkers(ctrl, 0, 1); n != 1 {
+		t.Errorf("Workers() after idle = %d, want 1", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxRunning != 4 {
+		t.Errorf("max running = %d, want 4", maxRunning)
+	}
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("HashExec events ran %v, want put order", order)
+		}
+	}
+	want := []ScaleReason{ScaleUpBacklog, ScaleUpBacklog, ScaleUpBacklog, ScaleDownIdle, ScaleDownIdle, ScaleDownIdle}
+	if len(reasons) != len(want) {
+		t.Fatalf("scale reasons = %v, want %v", reasons, want)
+	}
+	for i := range want {
+		if reasons[i] != want[i] {
+			t.Fatalf("scale reasons = %v, want %v", reasons, want)
+		}
+	}
+	ctrl.Stop(context.Background())
+}
+
+func TestAutoscaleWait(t *testing.T) {
+	for _, allow := range []bool{true, false} {
+		ctrl := NewCtrl("autoscale", 1, 64, DefaultHash)
+		var asked int64
+		ctrl.Autoscale = &Autoscale{
+			MaxWorkers: 2,
+			MaxWait:    5 * time.Millisecond,
+			OnScale: func(queueIndex, workers int, reason ScaleReason) bool {
+				if reason != ScaleUpWait {
+					return false
+				}
+				atomic.AddInt64(&asked, 1)
+				return allow
+			},
+		}
+		ctrl.Run()
+		for i := 0; i < 6; i++ {
+			ctrl.EventPut(NewData("", i, func(data any) error {
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			}), RRExec)
+		}
+		//hook被问过之后worker数才有结论
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt64(&asked) == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		want := 1
+		if allow {
+			want = 2
+		}
+		if n := waitWorkers(ctrl, 0, want); n != want {
+			t.Errorf("Workers() with hook allowing %v = %d, want %d", allow, n, want)
+		}
+		ctrl.Stop(context.Background())
+	}
+}
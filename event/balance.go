@@ -0,0 +1,33 @@
+package event
+
+import "math/rand"
+
+// getQueueIndexByLoad must be called with c.queueMu held. 从轮询位置开始找负载最小的队列, 负载相同时分散到不同队列
+func (c *Ctrl) getQueueIndexByLoad() int {
+	start := c.GetQueueIndexByRR()
+	best, bestLoad := start, c.queues[start].load()
+	for i := 1; i < len(c.queues) && bestLoad > 0; i++ {
+		index := (start + i) % len(c.queues)
+		if load := c.queues[index].load(); load < bestLoad {
+			best, bestLoad = index, load
+		}
+	}
+	return best
+}
+
+// getQueueIndexByP2C must be called with c.queueMu held
+func (c *Ctrl) getQueueIndexByP2C() int {
+	n := len(c.queues)
+	if n == 1 {
+		return 0
+	}
+	i := rand.Intn(n)
+	j := rand.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+	if c.queues[j].load() < c.queues[i].load() {
+		return j
+	}
+	return i
+}
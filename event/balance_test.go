@@ -0,0 +1,39 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestCtrlLoadBalance(t *testing.T) {
+	for _, execType := range []ExecType{LeastLoadedExec, P2CExec} {
+		ctrl := NewCtrl("balance", 2, 32, DefaultHash)
+		ctrl.Run()
+		release := make(chan struct{})
+		busy := ctrl.GetQueueIndexByHash("busy")
+		for i := 0; i < 10; i++ {
+			ctrl.EventPut(NewData("busy", i, func(data any) error {
+				<-release
+				return nil
+			}), HashExec)
+		}
+		var mu sync.Mutex
+		queues := map[int]int{}
+		for i := 0; i < 5; i++ {
+			data := NewData("", i, nil)
+			data.Handle = func(any) error {
+				mu.Lock()
+				defer mu.Unlock()
+				queues[data.QueueIndex]++
+				return nil
+			}
+			ctrl.EventPut(data, execType)
+		}
+		close(release)
+		ctrl.Stop(context.Background())
+		if queues[1-busy] != 5 {
+			t.Errorf("execType %d: queues = %v, want all 5 events on queue %d", execType, queues, 1-busy)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const defaultBatchSize = 100
+
+// BatchHandle handles several events of one queue at once. Returning a *BatchError fails only the
+// events it lists, any other error fails the whole batch.
+type BatchHandle func(batch []*Data) error
+
+// BatchError reports the events of a batch that failed, keyed by their index in the batch
+type BatchError struct {
+	Errors map[int]error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("event: %d events of the batch failed", len(e.Errors))
+}
+
+// batchErrors 把BatchHandle的返回值展开为每个事件的错误
+func batchErrors(err error, n int) []error {
+	errs := make([]error, n)
+	if err == nil {
+		return errs
+	}
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	for i, e := range batchErr.Errors {
+		if i >= 0 && i < n {
+			errs[i] = e
+		}
+	}
+	return errs
+}
+
+// popBatch 阻塞直到取到第一个事件, 之后最多再等待wait从自己的队列凑满n个
+func (c *Ctrl) popBatch(q *queue, n int, wait time.Duration) ([]*Data, bool) {
+	e, ok := c.next(q)
+	if !ok {
+		return nil, false
+	}
+	batch := []*Data{e}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(batch) < n {
+		if q.ready() {
+			batch = append(batch, q.take())
+			continue
+		}
+		if q.closed {
+			break
+		}
+		notify := q.waitChan()
+		q.mu.Unlock()
+		select {
+		case <-notify:
+			q.mu.Lock()
+		case <-timer.C:
+			q.mu.Lock()
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// runBatch 批量模式的worker
+func (c *Ctrl) runBatch(q *queue) {
+	defer c.wg.Done()
+	size := c.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	for {
+		batch, ok := c.popBatch(q, size, c.BatchWait)
+		if !ok {
+			return
+		}
+		//批量模式没有context, 只能跳过开始前被取消的事件
+		run := make([]*Data, 0, len(batch))
+		for _, e := range batch {
+			if e.cancel != nil && !e.cancel.start(func() {}) {
+				e.complete(context.Canceled)
+				continue
+			}
+			if c.expire(e) {
+				e.complete(ErrExpired)
+				continue
+			}
+			c.throttle(e)
+			run = append(run, e)
+		}
+		if len(run) > 0 {
+			for i, err := range c.execBatch(run) {
+				run[i].complete(err)
+			}
+		}
+		q.finish(batch...)
+		for _, e := range batch {
+			if e.cancel != nil {
+				e.cancel.finish()
+			}
+			c.ack(e)
+			atomic.AddInt64(&c.pending, -1)
+		}
+	}
+}
+
+// execBatch ...
+func (c *Ctrl) execBatch(batch []*Data) []error {
+	observer := c.Observer
+	execStart := time.Now()
+	if observer != nil {
+		for _, e := range batch {
+			wait := execStart.Sub(e.InQueueTime)
+			observer.OnDequeue(c.Name, e, wait)
+			observer.OnExecStart(c.Name, e, wait)
+		}
+	}
+	errs := c.handleBatch(batch)
+	if observer != nil {
+		exec := time.Since(execStart)
+		for i, e := range batch {
+			observer.OnExecEnd(c.Name, e, execStart.Sub(e.InQueueTime), exec, errs[i])
+		}
+	}
+	return errs
+}
+
+// handleBatch 失败的事件按各自的重试策略组成新的批次重试, 重试期间队列不处理新事件.
+// 同key的HashExec事件中有一个要重试时, 批次里排在它后面的同key事件一起重试, 保证按key的顺序
+func (c *Ctrl) handleBatch(batch []*Data) []error {
+	errs := make([]error, len(batch))
+	todo := batch
+	index := make([]int, len(batch))
+	for i := range index {
+		index[i] = i
+	}
+	for len(todo) > 0 {
+		for _, e := range todo {
+			e.Attempts++
+		}
+		failures := batchErrors(c.callBatch(todo), len(todo))
+		var retry []*Data
+		var retryIndex []int
+		var delay time.Duration
+		retryKeys := map[string]bool{}
+		for j, e := range todo {
+			errs[index[j]] = failures[j]
+			policy := c.retryPolicy(e)
+			if policy.ShouldRetry(failures[j], e.Attempts) {
+				if d := policy.Backoff(e.Attempts); d > delay {
+					delay = d
+				}
+				if keyed(e) {
+					retryKeys[e.Key] = true
+				}
+			} else if !keyed(e) || !retryKeys[e.Key] {
+				continue
+			}
+			retry = append(retry, e)
+			retryIndex = append(retryIndex, index[j])
+		}
+		if len(retry) > 0 && !sleepCtx(c.runCtx, delay) {
+			break
+		}
+		todo, index = retry, retryIndex
+	}
+	if c.DeadLetter != nil {
+		for i, e := range batch {
+			if errs[i] != nil {
+				c.DeadLetter(e, errs[i], e.Attempts)
+			}
+		}
+	}
+	return errs
+}
+
+// callBatch 执行一次BatchHandle, panic被恢复为 *PanicError 并作为整批的错误
+func (c *Ctrl) callBatch(batch []*Data) (err error) {
+	defer recoverPanic(&err, func(p *PanicError) { c.panicked(batch[0], p) })
+	return c.BatchHandle(batch)
+}
@@ -0,0 +1,119 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCtrlBatchHandle(t *testing.T) {
+	ctrl := NewCtrl("batch", 1, 16, DefaultHash)
+	ctrl.BatchSize = 3
+	ctrl.BatchWait = 50 * time.Millisecond
+	var mu sync.Mutex
+	var batches [][]int
+	ctrl.BatchHandle = func(batch []*Data) error {
+		mu.Lock()
+		defer mu.Unlock()
+		var values []int
+		for _, e := range batch {
+			values = append(values, e.Data.(int))
+		}
+		batches = append(batches, values)
+		return nil
+	}
+	ctrl.Run()
+	for i := 0; i < 7; i++ {
+		ctrl.EventPut(NewData("", i, nil), RRExec)
+	}
+	ctrl.Stop(context.Background())
+	if got, want := fmt.Sprint(batches), "[[0 1 2] [3 4 5] [6]]"; got != want {
+		t.Errorf("batches = %s, want %s", got, want)
+	}
+}
+
+func TestCtrlBatchPartialFailure(t *testing.T) {
+	ctrl := NewCtrl("batch-failure", 1, 16, DefaultHash)
+	ctrl.BatchSize = 4
+	ctrl.BatchWait = 50 * time.Millisecond
+	ctrl.Retry = &RetryPolicy{MaxAttempts: 3}
+	var mu sync.Mutex
+	var calls []string
+	ctrl.BatchHandle = func(batch []*Data) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batchErr := &BatchError{Errors: map[int]error{}}
+		var values []string
+		for i, e := range batch {
+			values = append(values, e.Key)
+			switch e.Key {
+			case "bad":
+				batchErr.Errors[i] = errTest
+			case "flaky":
+				if e.Attempts == 1 {
+					batchErr.Errors[i] = errTest
+				}
+			case "fatal":
+				batchErr.Errors[i] = Permanent(errTest)
+			}
+		}
+		calls = append(calls, fmt.Sprint(values))
+		return batchErr
+	}
+	var dead []string
+	ctrl.DeadLetter = func(data *Data, err error, attempts int) {
+		if !errors.Is(err, errTest) {
+			t.Errorf("DeadLetter() err = %v, want %v", err, errTest)
+		}
+		dead = append(dead, fmt.Sprintf("%s:%d", data.Key, attempts))
+	}
+	ctrl.Run()
+	for _, key := range []string{"ok", "bad", "flaky", "fatal"} {
+		ctrl.EventPut(NewData(key, nil, nil), RRExec)
+	}
+	ctrl.Stop(context.Background())
+	if got, want := fmt.Sprint(calls), "[[ok bad flaky fatal] [bad flaky] [bad]]"; got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprint(dead), "[bad:3 fatal:1]"; got != want {
+		t.Errorf("dead = %s, want %s", got, want)
+	}
+}
+
+func TestCtrlBatchRetryOrder(t *testing.T) {
+	ctrl := NewCtrl("batch-order", 1, 16, DefaultHash)
+	ctrl.BatchSize = 3
+	ctrl.BatchWait = 50 * time.Millisecond
+	ctrl.Retry = &RetryPolicy{MaxAttempts: 3}
+	var calls []string
+	last := map[string]int{}
+	ctrl.BatchHandle = func(batch []*Data) error {
+		batchErr := &BatchError{Errors: map[int]error{}}
+		var values []string
+		for i, e := range batch {
+			values = append(values, fmt.Sprintf("%s:%d", e.Key, e.Data))
+			if e.Data == 0 && e.Attempts == 1 {
+				batchErr.Errors[i] = errTest
+				continue
+			}
+			last[e.Key] = e.Data.(int)
+		}
+		calls = append(calls, fmt.Sprint(values))
+		return batchErr
+	}
+	ctrl.Run()
+	for i, key := range []string{"k", "k", "j"} {
+		ctrl.EventPut(NewData(key, i, nil), HashExec)
+	}
+	ctrl.Stop(context.Background())
+	//k:0重试时k:1跟着重试, 最后生效的仍是k:1
+	if got, want := fmt.Sprint(calls), "[[k:0 k:1 j:2] [k:0 k:1]]"; got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+	if last["k"] != 1 {
+		t.Errorf("last k = %d, want 1", last["k"])
+	}
+}
@@ -0,0 +1,299 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFailureRatio = 0.5
+	defaultMinRequests  = 10
+	defaultWindow       = 10 * time.Second
+	defaultCoolDown     = 5 * time.Second
+)
+
+// ErrBreakerOpen is the error of the events refused by an open Breaker
+var ErrBreakerOpen = errors.New("event: circuit breaker open")
+
+// errRescheduled exec的结果, 事件已交给延迟调度, 还没有结束
+var errRescheduled = errors.New("event: rescheduled")
+
+// BreakerState ...
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota //正常执行, 统计失败比例
+	BreakerOpen                         //拒绝执行, CoolDown后转为半开
+	BreakerHalfOpen                     //只放行HalfOpenMax次试探
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerMode is what happens to an event while the Breaker refuses it
+type BreakerMode int
+
+const (
+	BreakerFailFast   BreakerMode = iota //立即以 ErrBreakerOpen 失败, 进入死信流程, 不重试
+	BreakerPark                          //worker等到熔断器放行, 队列中的事件原地等待
+	BreakerReschedule                    //事件离开队列, 冷却结束时重新放入(仍计入pending, TTL从最初入队算); 同key事件的顺序不再保证
+)
+
+// Breaker is a circuit breaker. It counts the results of the handles in a window while closed,
+// opens when the failure ratio reaches FailureRatio, refuses events for CoolDown and then lets
+// HalfOpenMax trials through: it closes once they all succeed and opens again on the first failure.
+// Set it as Ctrl.Breaker to guard every event of the Ctrl, or wrap single handles with Wrap or
+// Middleware. The zero value is ready to use; a Breaker must not be copied after first use.
+type Breaker struct {
+	FailureRatio  float64                     //失败比例阈值, <=0 取0.5
+	MinRequests   int                         //窗口内执行次数达到该值才判断失败比例, <=0 取10
+	Window        time.Duration               //关闭状态下的统计窗口, <=0 取10s
+	CoolDown      time.Duration               //打开多久后转为半开, <=0 取5s
+	HalfOpenMax   int                         //半开状态的试探次数, <=0 取1
+	Mode          BreakerMode                 //打开时事件的处理方式
+	OnStateChange func(from, to BreakerState) //状态变化后调用
+
+	mu          sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	until       time.Time //打开状态的结束时间
+	trials      int       //半开状态下执行中的试探
+	successes   int       //半开状态下成功的试探
+	notify      chan struct{}
+}
+
+// State ...
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	changed := b.refresh(time.Now())
+	state := b.state
+	b.mu.Unlock()
+	changed()
+	return state
+}
+
+func (b *Breaker) halfOpenMax() int {
+	if b.HalfOpenMax <= 0 {
+		return 1
+	}
+	return b.HalfOpenMax
+}
+
+// set must be called with b.mu held, 返回需要在解锁后调用的回调
+func (b *Breaker) set(to BreakerState, now time.Time) func() {
+	from := b.state
+	b.state = to
+	b.requests, b.failures, b.trials, b.successes = 0, 0, 0, 0
+	b.windowStart = now
+	if to == BreakerOpen {
+		coolDown := b.CoolDown
+		if coolDown <= 0 {
+			coolDown = defaultCoolDown
+		}
+		b.until = now.Add(coolDown)
+	}
+	if b.notify != nil {
+		close(b.notify)
+		b.notify = nil
+	}
+	hook := b.OnStateChange
+	if hook == nil || from == to {
+		return func() {}
+	}
+	return func() { hook(from, to) }
+}
+
+// refresh must be called with b.mu held, 冷却结束时转为半开, 关闭状态下窗口过期时清零
+func (b *Breaker) refresh(now time.Time) func() {
+	switch b.state {
+	case BreakerOpen:
+		if !now.Before(b.until) {
+			return b.set(BreakerHalfOpen, now)
+		}
+	case BreakerClosed:
+		window := b.Window
+		if window <= 0 {
+			window = defaultWindow
+		}
+		if now.Sub(b.windowStart) >= window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	}
+	return func() {}
+}
+
+// allow 是否放行一次执行, 放行后必须调用record或release
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	changed := b.refresh(time.Now())
+	ok := false
+	switch b.state {
+	case BreakerClosed:
+		ok = true
+	case BreakerHalfOpen:
+		if b.trials+b.successes < b.halfOpenMax() {
+			b.trials++
+			ok = true
+		}
+	}
+	b.mu.Unlock()
+	changed()
+	return ok
+}
+
+// record 记录一次放行的执行结果
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	now := time.Now()
+	changed := b.refresh(now)
+	switch b.state {
+	case BreakerClosed:
+		b.requests++
+		if err != nil {
+			b.failures++
+		}
+		ratio := b.FailureRatio
+		if ratio <= 0 {
+			ratio = defaultFailureRatio
+		}
+		minRequests := b.MinRequests
+		if minRequests <= 0 {
+			minRequests = defaultMinRequests
+		}
+		if b.requests >= minRequests && float64(b.failures) >= ratio*float64(b.requests) {
+			changed = b.set(BreakerOpen, now)
+		}
+	case BreakerHalfOpen:
+		if b.trials == 0 {
+			//打开前放行的执行
+			break
+		}
+		b.trials--
+		if err != nil {
+			changed = b.set(BreakerOpen, now)
+		} else if b.successes++; b.successes >= b.halfOpenMax() {
+			changed = b.set(BreakerClosed, now)
+		}
+	}
+	b.mu.Unlock()
+	changed()
+}
+
+// release 放行的执行没有结果(被取消)时归还试探名额
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.trials > 0 {
+		b.trials--
+		if b.notify != nil {
+			close(b.notify)
+			b.notify = nil
+		}
+	}
+}
+
+// retryAt 被拒绝的事件何时再试
+func (b *Breaker) retryAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		return b.until
+	}
+	coolDown := b.CoolDown
+	if coolDown <= 0 {
+		coolDown = defaultCoolDown
+	}
+	return time.Now().Add(coolDown)
+}
+
+// wait 阻塞到放行或ctx结束
+func (b *Breaker) wait(ctx context.Context) bool {
+	for {
+		if b.allow() {
+			return true
+		}
+		b.mu.Lock()
+		if b.notify == nil {
+			b.notify = make(chan struct{})
+		}
+		notify, open, d := b.notify, b.state == BreakerOpen, time.Until(b.until)
+		b.mu.Unlock()
+		if open {
+			//冷却结束时allow会转为半开
+			if !sleepCtx(ctx, d) {
+				return false
+			}
+			continue
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Wrap guards h with the breaker. While the breaker refuses, BreakerFailFast returns
+// Permanent(ErrBreakerOpen), BreakerPark waits for it to let the call through and
+// BreakerReschedule returns ErrBreakerOpen for the RetryPolicy to try again later.
+func (b *Breaker) Wrap(h HandleCtx) HandleCtx {
+	return func(ctx context.Context, data any) error {
+		switch {
+		case b.allow():
+		case b.Mode == BreakerPark:
+			if !b.wait(ctx) {
+				return ctx.Err()
+			}
+		case b.Mode == BreakerReschedule:
+			return ErrBreakerOpen
+		default:
+			return Permanent(ErrBreakerOpen)
+		}
+		err := h(ctx, data)
+		b.record(err)
+		return err
+	}
+}
+
+// Middleware returns Wrap as a Middleware, each attempt counts as one call
+func (b *Breaker) Middleware() Middleware {
+	return b.Wrap
+}
+
+// admit 执行事件前经过Ctrl.Breaker, 返回非nil时事件不执行
+func (c *Ctrl) admit(e *Data) error {
+	b := c.Breaker
+	if b.allow() {
+		return nil
+	}
+	switch b.Mode {
+	case BreakerPark:
+		if b.wait(c.runCtx) {
+			return nil
+		}
+	case BreakerReschedule:
+		e.rescheduled = true
+		if _, err := c.EventPutAt(e, b.retryAt(), e.execType); err == nil {
+			return errRescheduled
+		}
+		e.rescheduled = false
+	}
+	if c.DeadLetter != nil {
+		c.DeadLetter(e, ErrBreakerOpen, e.Attempts)
+	}
+	return ErrBreakerOpen
+}
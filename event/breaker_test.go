@@ -0,0 +1,190 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerWrap(t *testing.T) {
+	var transitions []string
+	b := &Breaker{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		CoolDown:     20 * time.Millisecond,
+		OnStateChange: func(from, to BreakerState) {
+			transitions = append(transitions, from.String()+">"+to.String())
+		},
+	}
+	calls := 0
+	fail := true
+	h := b.Wrap(func(ctx context.Context, data any) error {
+		calls++
+		if fail {
+			return errTest
+		}
+		return nil
+	})
+	ctx := context.Background()
+	for i := 0; i < 6; i++ {
+		h(ctx, nil)
+	}
+	if err := h(ctx, nil); !errors.Is(err, ErrBreakerOpen) || !IsPermanent(err) || calls != 4 {
+		t.Errorf("open breaker: err = %v after %d calls, want permanent %v after 4", err, calls, ErrBreakerOpen)
+	}
+	time.Sleep(25 * time.Millisecond)
+	if s := b.State(); s != BreakerHalfOpen {
+		t.Errorf("State() after cool-down = %s, want %s", s, BreakerHalfOpen)
+	}
+	fail = false
+	if err := h(ctx, nil); err != nil || b.State() != BreakerClosed {
+		t.Errorf("trial err = %v, State() = %s, want nil, %s", err, b.State(), BreakerClosed)
+	}
+	want := []string{"closed>open", "open>half-open", "half-open>closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+	}
+}
+
+// newBreakerCtrl 前两次执行失败使熔断器打开
+func newBreakerCtrl(mode BreakerMode, coolDown time.Duration) (*Ctrl, *[]error, *sync.Mutex) {
+	ctrl := NewCtrl("breaker", 1, 16, DefaultHash)
+	ctrl.Breaker = &Breaker{FailureRatio: 1, MinRequests: 2, CoolDown: coolDown, Mode: mode}
+	var mu sync.Mutex
+	var dead []error
+	ctrl.DeadLetter = func(data *Data, err error, attempts int) {
+		mu.Lock()
+		defer mu.Unlock()
+		dead = append(dead, err)
+	}
+	ctrl.Run()
+	for i := 0; i < 2; i++ {
+		ctrl.EventPut(NewData("k", nil, func(data any) error { return errTest }), HashExec)
+	}
+	return ctrl, &dead, &mu
+}
+
+func TestCtrlBreakerFailFast(t *testing.T) {
+	ctrl, dead, _ := newBreakerCtrl(BreakerFailFast, time.Hour)
+	calls := 0
+	for i := 0; i < 3; i++ {
+		ctrl.EventPut(NewData("k", nil, func(data any) error {
+			calls++
+			return nil
+		}), HashExec)
+	}
+	ctrl.Stop(context.Background())
+	if calls != 0 || len(*dead) != 5 || (*dead)[4] != ErrBreakerOpen {
+		t.Errorf("calls = %d, dead letters = %v, want 0 calls and 3 %v", calls, *dead, ErrBreakerOpen)
+	}
+}
+
+func TestCtrlBreakerPark(t *testing.T) {
+	ctrl, _, mu := newBreakerCtrl(BreakerPark, 30*time.Millisecond)
+	start := time.Now()
+	var order []int
+	for i := 0; i < 3; i++ {
+		ctrl.EventPut(NewData("k", i, func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, data.(int))
+			return nil
+		}), HashExec)
+	}
+	ctrl.Stop(context.Background())
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Errorf("parked events ran after %s, want after the cool-down", elapsed)
+	}
+	if len(order) != 3 || order[0] != 0 || order[1] != 1 || order[2] != 2 {
+		t.Errorf("parked events ran %v, want [0 1 2]", order)
+	}
+	if s := ctrl.Breaker.State(); s != BreakerClosed {
+		t.Errorf("State() = %s, want %s", s, BreakerClosed)
+	}
+}
+
+func TestCtrlBreakerReschedule(t *testing.T) {
+	ctrl, dead, _ := newBreakerCtrl(BreakerReschedule, 20*time.Millisecond)
+	f, err := EventCall(ctrl, "k", 7, func(ctx context.Context, data any) (int, error) {
+		return data.(int), nil
+	}, HashExec)
+	if err != nil {
+		t.Fatalf("EventCall() err = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if v, err := f.Wait(ctx); v != 7 || err != nil {
+		t.Errorf("rescheduled Wait() = %d, %v, want 7, nil", v, err)
+	}
+	if len(*dead) != 2 {
+		t.Errorf("dead letters = %v, want only the 2 failures", *dead)
+	}
+	ctrl.Stop(context.Background())
+}
+
+func TestCtrlBreakerReschedulePending(t *testing.T) {
+	ctrl, _, _ := newBreakerCtrl(BreakerReschedule, 30*time.Millisecond)
+	var ran int64
+	ctrl.EventPut(NewData("k", nil, func(data any) error {
+		atomic.AddInt64(&ran, 1)
+		return nil
+	}), HashExec)
+	//等待冷却时仍计入pending, Drain等到它真正执行完
+	if err := ctrl.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() err = %v", err)
+	}
+	if atomic.LoadInt64(&ran) != 1 || ctrl.Pending() != 0 {
+		t.Errorf("after Drain ran = %d, pending = %d, want 1, 0", ran, ctrl.Pending())
+	}
+	ctrl.Stop(context.Background())
+}
+
+func TestCtrlBreakerRescheduleTTL(t *testing.T) {
+	ctrl, _, _ := newBreakerCtrl(BreakerReschedule, 30*time.Millisecond)
+	var ran int64
+	data := NewData("k", nil, func(data any) error {
+		atomic.AddInt64(&ran, 1)
+		return nil
+	})
+	//TTL从最初入队算, 冷却时间超过TTL时不再执行
+	data.TTL = 10 * time.Millisecond
+	ctrl.EventPut(data, HashExec)
+	ctrl.Drain(context.Background())
+	if atomic.LoadInt64(&ran) != 0 || ctrl.Expired() != 1 {
+		t.Errorf("ran = %d, Expired() = %d, want 0, 1", ran, ctrl.Expired())
+	}
+	ctrl.Stop(context.Background())
+}
+
+func TestCtrlBreakerRescheduleStop(t *testing.T) {
+	ctrl, _, _ := newBreakerCtrl(BreakerReschedule, time.Hour)
+	ctrl.EventPut(NewData("k", nil, func(data any) error { return nil }), HashExec)
+	scheduled := func() int {
+		ctrl.putMu.RLock()
+		defer ctrl.putMu.RUnlock()
+		if ctrl.delay == nil {
+			return 0
+		}
+		ctrl.delay.mu.Lock()
+		defer ctrl.delay.mu.Unlock()
+		return len(ctrl.delay.items)
+	}
+	deadline := time.Now().Add(time.Second)
+	for scheduled() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := ctrl.Pending(); n != 1 {
+		t.Errorf("Pending() while rescheduled = %d, want 1", n)
+	}
+	if abandoned, _ := ctrl.Stop(context.Background()); abandoned != 1 || ctrl.Pending() != 0 {
+		t.Errorf("Stop() abandoned = %d, pending = %d, want 1, 0", abandoned, ctrl.Pending())
+	}
+}
@@ -0,0 +1,172 @@
+package event
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BusHandle handles a message published to topic
+type BusHandle func(topic string, data any) error
+
+// Bus is a topic based publish/subscribe bus. Every subscription owns a single queue Ctrl, so it
+// sees the messages in publish order and its errors, retries and panics do not affect the others.
+type Bus struct {
+	Name           string
+	ChanBufferSize int64
+	Setup          func(ctrl *Ctrl) //订阅的Ctrl在Run之前的配置, 如Retry/DeadLetter/Observer
+	PutTimeout     time.Duration    //订阅的队列满时Publish最多等待多久, 0 一直等待, 负数不等待
+
+	mu     sync.RWMutex
+	nextID int64
+	subs   []*Subscription
+	closed bool
+}
+
+// Subscription ...
+type Subscription struct {
+	ID      int64
+	Pattern string
+	Ctrl    *Ctrl
+	handle  BusHandle
+	bus     *Bus
+}
+
+// NewBus ...
+func NewBus(name string, chanBufferSize int64) *Bus {
+	return &Bus{
+		Name:           name,
+		ChanBufferSize: chanBufferSize,
+	}
+}
+
+// MatchTopic reports whether topic matches pattern. Both are split on '.', '*' matches exactly one
+// segment and '#' matches zero or more segments, e.g. "order.*" matches "order.created".
+func MatchTopic(pattern, topic string) bool {
+	return matchSegments(strings.Split(pattern, "."), strings.Split(topic, "."))
+}
+
+func matchSegments(pattern, topic []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			for i := 0; i <= len(topic); i++ {
+				if matchSegments(pattern[1:], topic[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+		default:
+			if len(topic) == 0 || pattern[0] != topic[0] {
+				return false
+			}
+		}
+		if len(topic) == 0 {
+			return false
+		}
+		pattern, topic = pattern[1:], topic[1:]
+	}
+	return len(topic) == 0
+}
+
+// Subscribe starts a subscription of the topics matching pattern
+func (b *Bus) Subscribe(pattern string, handle BusHandle) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	b.nextID++
+	sub := &Subscription{
+		ID:      b.nextID,
+		Pattern: pattern,
+		Ctrl:    NewCtrl(b.Name+"/"+pattern, 1, b.ChanBufferSize, nil),
+		handle:  handle,
+		bus:     b,
+	}
+	sub.Ctrl.EventChan = nil
+	if b.Setup != nil {
+		b.Setup(sub.Ctrl)
+	}
+	sub.Ctrl.Run()
+	b.subs = append(b.subs, sub)
+	return sub, nil
+}
+
+// Publish puts data into the queue of every subscription matching topic and returns how many accepted
+// it. A subscription whose queue stays full longer than PutTimeout is skipped.
+func (b *Bus) Publish(topic string, data any) int {
+	//入队可能阻塞, 不能持有锁, 否则一个卡住的订阅会挡住Subscribe/Unsubscribe/Close
+	b.mu.RLock()
+	var subs []*Subscription
+	for _, sub := range b.subs {
+		if MatchTopic(sub.Pattern, topic) {
+			subs = append(subs, sub)
+		}
+	}
+	b.mu.RUnlock()
+	delivered := 0
+	for _, sub := range subs {
+		handle := sub.handle
+		if b.put(sub, NewData(topic, data, func(data any) error {
+			return handle(topic, data)
+		})) == nil {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// put 按PutTimeout入队
+func (b *Bus) put(sub *Subscription, data *Data) error {
+	if b.PutTimeout < 0 {
+		return sub.Ctrl.TryPut(data, HashExec)
+	}
+	ctx := context.Background()
+	if b.PutTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.PutTimeout)
+		defer cancel()
+	}
+	return sub.Ctrl.PutWithTimeout(ctx, data, HashExec)
+}
+
+// Unsubscribe removes the subscription from the bus and stops its Ctrl, see Ctrl.Stop
+func (s *Subscription) Unsubscribe(ctx context.Context) (int, error) {
+	b := s.bus
+	b.mu.Lock()
+	for i, sub := range b.subs {
+		if sub == s {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+	return s.Ctrl.Stop(ctx)
+}
+
+// Close stops every subscription and returns the number of abandoned messages
+func (b *Bus) Close(ctx context.Context) (int, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return 0, ErrClosed
+	}
+	b.closed = true
+	subs := b.subs
+	b.subs = nil
+	b.mu.Unlock()
+
+	abandoned := 0
+	var err error
+	for _, sub := range subs {
+		n, stopErr := sub.Ctrl.Stop(ctx)
+		abandoned += n
+		if stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+	return abandoned, err
+}
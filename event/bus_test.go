@@ -0,0 +1,131 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.created", "order.paid", false},
+		{"order.*", "order.created", true},
+		{"order.*", "order", false},
+		{"order.*", "order.created.v2", false},
+		{"*.created", "user.created", true},
+		{"order.#", "order", true},
+		{"order.#", "order.created.v2", true},
+		{"#.v2", "order.created.v2", true},
+		{"#", "anything.at.all", true},
+		{"user.#", "order.created", false},
+	}
+	for _, tc := range cases {
+		if got := MatchTopic(tc.pattern, tc.topic); got != tc.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tc.pattern, tc.topic, got, tc.want)
+		}
+	}
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus("bus", 16)
+	var dead int
+	bus.Setup = func(ctrl *Ctrl) {
+		ctrl.DeadLetter = func(data *Data, err error, attempts int) { dead++ }
+	}
+	var mu sync.Mutex
+	got := map[string][]string{}
+	record := func(name string) BusHandle {
+		return func(topic string, data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[name] = append(got[name], fmt.Sprintf("%s:%v", topic, data))
+			return nil
+		}
+	}
+	bus.Subscribe("order.*", record("orders"))
+	bus.Subscribe("#", record("all"))
+	bus.Subscribe("order.created", func(topic string, data any) error { panic("boom") })
+	paid, _ := bus.Subscribe("order.paid", record("paid"))
+
+	if n := bus.Publish("order.created", 1); n != 3 {
+		t.Errorf("Publish(order.created) = %d, want 3", n)
+	}
+	bus.Publish("order.paid", 2)
+	paid.Unsubscribe(context.Background())
+	bus.Publish("order.paid", 3)
+	bus.Publish("user.created", 4)
+	if _, err := bus.Close(context.Background()); err != nil {
+		t.Fatalf("Close() err = %v", err)
+	}
+
+	wants := map[string]string{
+		"orders": "[order.created:1 order.paid:2 order.paid:3]",
+		"all":    "[order.created:1 order.paid:2 order.paid:3 user.created:4]",
+		"paid":   "[order.paid:2]",
+	}
+	for name, want := range wants {
+		if fmt.Sprint(got[name]) != want {
+			t.Errorf("%s got %v, want %s", name, got[name], want)
+		}
+	}
+	if dead != 1 {
+		t.Errorf("dead = %d, want 1", dead)
+	}
+	if _, err := bus.Subscribe("x", nil); err != ErrClosed {
+		t.Errorf("Subscribe() after Close err = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestBusSlowSubscriber(t *testing.T) {
+	bus := NewBus("bus", 1)
+	bus.PutTimeout = 50 * time.Millisecond
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	bus.Subscribe("order.*", func(topic string, data any) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	fast := make(chan any, 16)
+	bus.Subscribe("#", func(topic string, data any) error {
+		fast <- data
+		return nil
+	})
+	bus.Publish("order.created", 1)
+	<-started
+	//慢订阅一个在执行一个在队列中, 第三个等待PutTimeout后跳过
+	for i, want := range []int{2, 1} {
+		if n := bus.Publish("order.created", i+2); n != want {
+			t.Errorf("Publish(%d) = %d, want %d", i+2, n, want)
+		}
+	}
+	for want := 1; want <= 3; want++ {
+		select {
+		case got := <-fast:
+			if got != want {
+				t.Errorf("fast subscriber got %v, want %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("fast subscriber did not get %d", want)
+		}
+	}
+
+	//一直等待的Publish卡在慢订阅上时不挡住Close
+	bus.PutTimeout = 0
+	published := make(chan int)
+	go func() { published <- bus.Publish("order.created", 4) }()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	bus.Close(ctx)
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Errorf("Publish() still blocked after Close")
+	}
+	close(release)
+}
@@ -0,0 +1,178 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HandleCtx is a Handle that receives the context of the execution. The context is canceled when the
+// event's CancelFunc is called, when its Deadline or Timeout is reached, or when Ctrl.Stop gives up
+// waiting; Ctrl.Done tells that Stop has started.
+type HandleCtx func(ctx context.Context, data any) error
+
+// CancelFunc removes the event if it has not started yet or cancels the context of its running
+// handle, it returns false when the event already finished or was canceled before
+type CancelFunc func() bool
+
+// DataOption ...
+type DataOption func(data *Data)
+
+// WithDeadline sets the time by which the event must be handled, an event that reaches it before
+// starting is not executed and goes to the dead-letter path with context.DeadlineExceeded
+func WithDeadline(deadline time.Time) DataOption {
+	return func(data *Data) {
+		data.Deadline = deadline
+	}
+}
+
+// WithTimeout limits the execution of the event, retries included, starting when it leaves the queue
+func WithTimeout(timeout time.Duration) DataOption {
+	return func(data *Data) {
+		data.Timeout = timeout
+	}
+}
+
+// NewDataCtx ...
+func NewDataCtx(key string, data any, handle HandleCtx, opts ...DataOption) *Data {
+	eventData := NewData(key, data, nil, opts...)
+	eventData.HandleCtx = handle
+	return eventData
+}
+
+type cancelState struct {
+	mu       sync.Mutex
+	started  bool
+	done     bool
+	canceled bool
+	cancel   context.CancelFunc //执行中的context
+}
+
+// start 事件开始执行前调用, 已取消时返回false
+func (s *cancelState) start(cancel context.CancelFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.canceled {
+		return false
+	}
+	s.started, s.cancel = true, cancel
+	return true
+}
+
+func (s *cancelState) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done, s.cancel = true, nil
+}
+
+func (s *cancelState) isCanceled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.canceled
+}
+
+// EventPutWithCancel is EventPut that returns a CancelFunc for the event
+func (c *Ctrl) EventPutWithCancel(data *Data, execType ExecType) (CancelFunc, error) {
+	if data == nil {
+		return nil, ErrNilData
+	}
+	data.cancel = &cancelState{}
+	if err := c.put(context.Background(), data, execType, true); err != nil {
+		return nil, err
+	}
+	return func() bool {
+		return c.cancelEvent(data)
+	}, nil
+}
+
+// cancelEvent ...
+func (c *Ctrl) cancelEvent(data *Data) bool {
+	s := data.cancel
+	s.mu.Lock()
+	if s.canceled || s.done {
+		s.mu.Unlock()
+		return false
+	}
+	s.canceled = true
+	if s.started {
+		s.cancel()
+		s.mu.Unlock()
+		return true
+	}
+	s.mu.Unlock()
+	//还在队列中就直接移除; 已被worker取出但未开始的, worker看到canceled会跳过
+	c.queueMu.RLock()
+	defer c.queueMu.RUnlock()
+	removed := false
+	if data.execType == KeyExec {
+		//KeyExec事件入队前已创建keys
+		removed = c.keys.remove(data)
+	} else if data.QueueIndex >= 0 && data.QueueIndex < len(c.queues) {
+		removed = c.queues[data.QueueIndex].removeData(data)
+	}
+	if removed {
+		data.complete(context.Canceled)
+		c.ack(data)
+		atomic.AddInt64(&c.pending, -1)
+	}
+	return true
+}
+
+// eventContext 返回事件执行用的context; 事件已被取消时返回false
+func (c *Ctrl) eventContext(e *Data) (context.Context, context.CancelFunc, bool) {
+	ctx := c.runCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var cancels []context.CancelFunc
+	if !e.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, e.Deadline)
+		cancels = append(cancels, cancel)
+	}
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		cancels = append(cancels, cancel)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cancels = append(cancels, cancel)
+	cancelAll := func() {
+		for i := len(cancels) - 1; i >= 0; i-- {
+			cancels[i]()
+		}
+	}
+	if e.cancel != nil && !e.cancel.start(cancel) {
+		cancelAll()
+		return nil, nil, false
+	}
+	return ctx, cancelAll, true
+}
+
+// canceledByCaller 事件是否被自己的CancelFunc取消
+func canceledByCaller(e *Data) bool {
+	return e.cancel != nil && e.cancel.isCanceled()
+}
+
+// Done is closed when Stop is called
+func (c *Ctrl) Done() <-chan struct{} {
+	c.putMu.RLock()
+	defer c.putMu.RUnlock()
+	return c.stopping
+}
+
+// sleepCtx 等待d, ctx结束时提前返回false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,96 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCtrlEventPutWithCancel(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 16)
+	var ran int64
+	queued, err := ctrl.EventPutWithCancel(NewData("", nil, func(data any) error {
+		atomic.AddInt64(&ran, 1)
+		return nil
+	}), RRExec)
+	if err != nil {
+		t.Fatalf("EventPutWithCancel() err = %v", err)
+	}
+	if !queued() || queued() {
+		t.Errorf("cancel queued event want true then false")
+	}
+	if got := ctrl.Pending(); got != 1 {
+		t.Errorf("Pending() = %d, want 1", got)
+	}
+
+	started := make(chan struct{})
+	running, _ := ctrl.EventPutWithCancel(NewDataCtx("", nil, func(ctx context.Context, data any) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}), RRExec)
+	var dead int64
+	ctrl.DeadLetter = func(data *Data, err error, attempts int) { atomic.AddInt64(&dead, 1) }
+	close(release)
+	<-started
+	if !running() {
+		t.Errorf("cancel running event = false, want true")
+	}
+	ctrl.Stop(context.Background())
+	if running() {
+		t.Errorf("cancel finished event = true, want false")
+	}
+	if ran != 0 || dead != 0 {
+		t.Errorf("ran = %d, dead = %d, want canceled events neither run nor dead-lettered", ran, dead)
+	}
+}
+
+func TestCtrlDataDeadline(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 16)
+	ctrl.Retry = &RetryPolicy{MaxAttempts: 100, BaseDelay: time.Millisecond}
+	var deadErrs []error
+	ctrl.DeadLetter = func(data *Data, err error, attempts int) {
+		deadErrs = append(deadErrs, err)
+	}
+	var ran int64
+	ctrl.EventPut(NewData("", nil, func(data any) error {
+		atomic.AddInt64(&ran, 1)
+		return nil
+	}, WithDeadline(time.Now().Add(-time.Second))), RRExec)
+	var hasDeadline int64
+	ctrl.EventPut(NewDataCtx("", nil, func(ctx context.Context, data any) error {
+		if _, ok := ctx.Deadline(); ok {
+			atomic.StoreInt64(&hasDeadline, 1)
+		}
+		return errTest
+	}, WithTimeout(20*time.Millisecond)), RRExec)
+	close(release)
+	ctrl.Stop(context.Background())
+	if ran != 0 || hasDeadline != 1 {
+		t.Errorf("ran = %d, hasDeadline = %d, want 0, 1", ran, hasDeadline)
+	}
+	if len(deadErrs) != 2 || !errors.Is(deadErrs[0], context.DeadlineExceeded) || !errors.Is(deadErrs[1], errTest) {
+		t.Errorf("dead-letter errors = %v, want [DeadlineExceeded, test error]", deadErrs)
+	}
+}
+
+func TestCtrlDone(t *testing.T) {
+	ctrl := NewCtrl("done", 1, 16, DefaultHash)
+	ctrl.Run()
+	sawStop := make(chan bool, 1)
+	ctrl.EventPut(NewData("", nil, func(data any) error {
+		select {
+		case <-ctrl.Done():
+			sawStop <- true
+		case <-time.After(time.Second):
+			sawStop <- false
+		}
+		return nil
+	}), RRExec)
+	ctrl.Stop(context.Background())
+	if !<-sawStop {
+		t.Errorf("handle did not see Done() closed during Stop")
+	}
+}
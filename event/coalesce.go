@@ -0,0 +1,17 @@
+package event
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrCoalesced = errors.New("event: replaced by a newer event of the same key")
+
+// MergeFunc combines an event still waiting in the queue with a new one of the same key, the
+// result takes the place of pending. It runs while the queue is locked and must be fast.
+type MergeFunc func(pending, incoming *Data) *Data
+
+// Coalesced returns how many events were replaced or merged away by Coalesce
+func (c *Ctrl) Coalesced() int64 {
+	return atomic.LoadInt64(&c.coalesced)
+}
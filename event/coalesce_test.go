@@ -0,0 +1,55 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCtrlCoalesce(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 16)
+	ctrl.Coalesce = true
+	var mu sync.Mutex
+	var handled []string
+	handle := func(data any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, fmt.Sprint(data))
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		ctrl.EventPut(NewData("a", fmt.Sprintf("a%d", i), handle), HashExec)
+		ctrl.EventPut(NewData("b", fmt.Sprintf("b%d", i), handle), HashExec)
+		ctrl.EventPut(NewData("r", fmt.Sprintf("r%d", i), handle), RRExec)
+	}
+	close(release)
+	ctrl.Stop(context.Background())
+	if got, want := fmt.Sprint(handled), "[a2 b2 r0 r1 r2]"; got != want {
+		t.Errorf("handled = %s, want %s", got, want)
+	}
+	if got := ctrl.Coalesced(); got != 4 {
+		t.Errorf("Coalesced() = %d, want 4", got)
+	}
+}
+
+func TestCtrlCoalesceMerge(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 16)
+	ctrl.Coalesce = true
+	ctrl.Merge = func(pending, incoming *Data) *Data {
+		pending.Data = pending.Data.(int) + incoming.Data.(int)
+		return pending
+	}
+	var sum int
+	for i := 1; i <= 4; i++ {
+		ctrl.EventPut(NewData("counter", i, func(data any) error {
+			sum = data.(int)
+			return nil
+		}), HashExec)
+	}
+	close(release)
+	ctrl.Stop(context.Background())
+	if sum != 10 || ctrl.Coalesced() != 3 || ctrl.Pending() != 0 {
+		t.Errorf("sum = %d, coalesced = %d, pending = %d, want 10, 3, 0", sum, ctrl.Coalesced(), ctrl.Pending())
+	}
+}
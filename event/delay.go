@@ -0,0 +1,285 @@
+package event
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const redeliverPeriod = 10 * time.Millisecond
+
+// Scheduled is an event waiting in EventPutAfter / EventPutAt for its time
+type Scheduled struct {
+	Data     *Data
+	At       time.Time
+	execType ExecType
+	index    int    //在堆中的位置, -1 表示已投递或已取消
+	seq      uint64 //同一时间到期的事件按放入顺序投递
+	s        *scheduler
+}
+
+// Cancel removes the event if it has not been put into its queue yet
+func (s *Scheduled) Cancel() bool {
+	return s.s.cancel(s)
+}
+
+type scheduledHeap []*Scheduled
+
+func (h scheduledHeap) Len() int { return len(h) }
+func (h scheduledHeap) Less(i, j int) bool {
+	if h[i].At.Equal(h[j].At) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].At.Before(h[j].At)
+}
+func (h scheduledHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduledHeap) Push(x any) {
+	s := x.(*Scheduled)
+	s.index = len(*h)
+	*h = append(*h, s)
+}
+
+func (h *scheduledHeap) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	old[len(old)-1] = nil
+	s.index = -1
+	*h = old[:len(old)-1]
+	return s
+}
+
+// scheduler 按时间最小堆保存延迟事件, 一个goroutine在最早的事件到期时投递
+type scheduler struct {
+	ctrl   *Ctrl
+	mu     sync.Mutex
+	items  scheduledHeap
+	wake   chan struct{}
+	seq    uint64
+	held   map[string]time.Time //HashExec key因队列满推迟到的时间, 只在run goroutine中使用
+	closed bool
+}
+
+func newScheduler(ctrl *Ctrl) *scheduler {
+	s := &scheduler{
+		ctrl: ctrl,
+		wake: make(chan struct{}, 1),
+		held: make(map[string]time.Time),
+	}
+	go s.run()
+	return s
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) add(item *Scheduled) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	item.s = s
+	s.seq++
+	item.seq = s.seq
+	heap.Push(&s.items, item)
+	if item.index == 0 {
+		s.notify()
+	}
+	return nil
+}
+
+func (s *scheduler) cancel(item *Scheduled) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if item.index < 0 {
+		return false
+	}
+	heap.Remove(&s.items, item.index)
+	return true
+}
+
+// due 取出所有到期的事件, 并返回距下一个事件到期的时间
+func (s *scheduler) due(now time.Time) ([]*Scheduled, time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, 0, false
+	}
+	var due []*Scheduled
+	for len(s.items) > 0 && !s.items[0].At.After(now) {
+		due = append(due, heap.Pop(&s.items).(*Scheduled))
+	}
+	next := time.Duration(-1)
+	if len(s.items) > 0 {
+		next = s.items[0].At.Sub(now)
+	}
+	return due, next, true
+}
+
+func (s *scheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		due, next, ok := s.due(time.Now())
+		if !ok {
+			return
+		}
+		s.deliver(due)
+		if len(due) > 0 {
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next < 0 {
+			next = time.Hour
+		}
+		timer.Reset(next)
+		select {
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// deliver 不阻塞地把到期的事件放入队列, 一个队列满不影响其它队列. OverflowBlock的队列满时稍后重试,
+// 同key在此之前到期的事件一起推迟以保持顺序; 其它失败交给OnDrop(OverflowReject)或DeadLetter
+func (s *scheduler) deliver(due []*Scheduled) {
+	c := s.ctrl
+	now := time.Now()
+	var retry []*Scheduled
+	for _, item := range due {
+		if item.execType == HashExec {
+			if until, ok := s.held[item.Data.Key]; ok && now.Before(until) {
+				item.At = until
+				retry = append(retry, item)
+				continue
+			}
+			delete(s.held, item.Data.Key)
+		}
+		//被熔断器重新调度的事件在Stop之前就已入队, 不检查closed, 队列关闭时失败
+		rescheduled := item.Data.rescheduled
+		var err error
+		if rescheduled {
+			err = c.enqueue(context.Background(), item.Data, item.execType, false)
+		} else {
+			err = c.put(context.Background(), item.Data, item.execType, false)
+		}
+		switch {
+		case err == nil || errors.Is(err, ErrDropped):
+			//被溢出策略丢弃的事件已经交给OnDrop
+		case errors.Is(err, ErrQueueFull) && c.Overflow == OverflowBlock:
+			item.Data.rescheduled = rescheduled
+			item.At = now.Add(redeliverPeriod)
+			if item.execType == HashExec {
+				s.held[item.Data.Key] = item.At
+			}
+			retry = append(retry, item)
+		case errors.Is(err, ErrQueueFull) && c.OnDrop != nil:
+			s.finish(item.Data, rescheduled, err)
+			c.OnDrop(item.Data, c.Overflow)
+		default:
+			s.finish(item.Data, rescheduled, err)
+			if c.DeadLetter != nil {
+				c.DeadLetter(item.Data, err, item.Data.Attempts)
+			}
+		}
+	}
+	if len(retry) > 0 {
+		s.retry(retry)
+	}
+}
+
+// finish 投递失败的事件结束, 被熔断器重新调度的事件此时才确认
+func (s *scheduler) finish(e *Data, rescheduled bool, err error) {
+	e.complete(err)
+	if rescheduled {
+		s.ctrl.ack(e)
+		atomic.AddInt64(&s.ctrl.pending, -1)
+	}
+}
+
+// abandon Stop放弃的事件, 被熔断器重新调度的事件不再计入pending, WAL中的记录留待重放
+func (s *scheduler) abandon(e *Data) {
+	e.complete(ErrClosed)
+	if e.rescheduled {
+		atomic.AddInt64(&s.ctrl.pending, -1)
+	}
+}
+
+// retry 把没能投递的事件按新的At放回堆中, 同时到期时仍按原来的顺序
+func (s *scheduler) retry(items []*Scheduled) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range items {
+		if s.closed {
+			s.abandon(item.Data)
+			continue
+		}
+		heap.Push(&s.items, item)
+	}
+}
+
+// close 停止投递, 返回还未到期的事件数
+func (s *scheduler) close() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0
+	}
+	s.closed = true
+	n := len(s.items)
+	for _, item := range s.items {
+		item.index = -1
+		s.abandon(item.Data)
+	}
+	s.items = nil
+	s.notify()
+	return n
+}
+
+// EventPutAfter puts data into its queue once delay has elapsed. Until then the event is neither
+// pending for Drain nor written to the WAL, and Stop discards it and counts it as abandoned. When
+// the queue is full under OverflowBlock the delivery is retried a little later; an event that cannot
+// be put otherwise goes to OnDrop (OverflowReject) or to DeadLetter with the error.
+func (c *Ctrl) EventPutAfter(data *Data, delay time.Duration, execType ExecType) (*Scheduled, error) {
+	return c.EventPutAt(data, time.Now().Add(delay), execType)
+}
+
+// EventPutAt puts data into its queue at time at, see EventPutAfter
+func (c *Ctrl) EventPutAt(data *Data, at time.Time, execType ExecType) (*Scheduled, error) {
+	if data == nil {
+		return nil, ErrNilData
+	}
+	c.putMu.Lock()
+	defer c.putMu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	if !c.isRun {
+		return nil, ErrNotRunning
+	}
+	if c.delay == nil {
+		c.delay = newScheduler(c)
+	}
+	item := &Scheduled{Data: data, At: at, execType: execType}
+	if err := c.delay.add(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
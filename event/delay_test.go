@@ -0,0 +1,135 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCtrlEventPutAfter(t *testing.T) {
+	ctrl := NewCtrl("delay", 2, 16, DefaultHash)
+	ctrl.Run()
+	var mu sync.Mutex
+	var order []string
+	done := make(chan struct{})
+	handle := func(data any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, data.(string))
+		if len(order) == 3 {
+			close(done)
+		}
+		return nil
+	}
+	start := time.Now()
+	ctrl.EventPutAfter(NewData("a", "30ms", handle), 30*time.Millisecond, HashExec)
+	ctrl.EventPutAt(NewData("b", "10ms", handle), start.Add(10*time.Millisecond), HashExec)
+	canceled, _ := ctrl.EventPutAfter(NewData("c", "15ms", handle), 15*time.Millisecond, RRExec)
+	ctrl.EventPutAfter(NewData("d", "20ms", handle), 20*time.Millisecond, RRExec)
+	if !canceled.Cancel() || canceled.Cancel() {
+		t.Errorf("Cancel() want true then false")
+	}
+	<-done
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("elapsed = %v, want >= 30ms", elapsed)
+	}
+	if got, want := fmt.Sprint(order), "[10ms 20ms 30ms]"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+
+	ctrl.EventPutAfter(NewData("e", "1h", handle), time.Hour, RRExec)
+	if abandoned, err := ctrl.Stop(context.Background()); abandoned != 1 || err != nil {
+		t.Errorf("Stop() = %d, %v, want 1, nil", abandoned, err)
+	}
+	if _, err := ctrl.EventPutAfter(NewData("f", "", handle), 0, RRExec); err != ErrClosed {
+		t.Errorf("EventPutAfter() after Stop err = %v, want %v", err, ErrClosed)
+	}
+}
+
+// keyOnQueue 返回hash到第i个队列的key
+func keyOnQueue(ctrl *Ctrl, i int) string {
+	for k := 0; ; k++ {
+		key := fmt.Sprintf("key:%d", k)
+		if ctrl.GetQueueIndexByHash(key) == i {
+			return key
+		}
+	}
+}
+
+func TestCtrlEventPutAfterFullQueue(t *testing.T) {
+	ctrl := NewCtrl("delay", 2, 1, DefaultHash)
+	ctrl.Run()
+	defer ctrl.Stop(context.Background())
+	full, free := keyOnQueue(ctrl, 0), keyOnQueue(ctrl, 1)
+	started, release := make(chan struct{}), make(chan struct{})
+	ctrl.EventPut(NewData(full, nil, func(data any) error {
+		close(started)
+		<-release
+		return nil
+	}), HashExec)
+	<-started
+	ctrl.EventPut(NewData(full, nil, nil), HashExec)
+
+	var mu sync.Mutex
+	var order []string
+	handle := func(data any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, data.(string))
+		return nil
+	}
+	ctrl.EventPutAfter(NewData(full, "full-1", handle), 0, HashExec)
+	ctrl.EventPutAfter(NewData(full, "full-2", handle), 5*time.Millisecond, HashExec)
+	ran := make(chan struct{})
+	ctrl.EventPutAfter(NewData(free, "free", func(data any) error {
+		close(ran)
+		return nil
+	}), 0, HashExec)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("delayed event of another queue waited for the full queue")
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(order)
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delayed events of the full queue never ran")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := fmt.Sprint(order), "[full-1 full-2]"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+
+}
+
+func TestCtrlEventPutAfterReject(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowReject, 1)
+	defer close(release)
+	dropped := make(chan any, 1)
+	ctrl.OnDrop = func(data *Data, policy OverflowPolicy) {
+		dropped <- data.Data
+	}
+	ctrl.EventPut(NewData("", nil, nil), RRExec)
+	ctrl.EventPutAfter(NewData("", "rejected", nil), 0, RRExec)
+	select {
+	case data := <-dropped:
+		if data != "rejected" {
+			t.Errorf("OnDrop() got %v, want rejected", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("rejected delayed event not passed to OnDrop")
+	}
+}
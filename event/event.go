@@ -1,17 +1,30 @@
 package event
 
 import (
+	"context"
+	"errors"
 	"hash/crc32"
-	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type ExecType = int
 
 const (
-	HashExec ExecType = iota //hash轮询
-	RRExec                   //循环轮询
+	HashExec        ExecType = iota //hash轮询
+	RRExec                          //循环轮询
+	LeastLoadedExec                 //待执行+执行中事件最少的队列
+	P2CExec                         //随机取两个队列, 选负载较小的一个
+	KeyExec                         //不经过队列, 同key串行, 不同key最多KeyConcurrency个并发
+)
+
+const drainPollPeriod = 10 * time.Millisecond
+
+var (
+	ErrClosed     = errors.New("event: ctrl closed")
+	ErrNotRunning = errors.New("event: ctrl not running")
+	ErrNilData    = errors.New("event: nil data")
 )
 
 type Handle func(data any) error
@@ -24,17 +37,83 @@ type Data struct {
 	QueueIndex  int
 	InQueueTime time.Time
 	Data        any
-	Handle      Handle //增加一个简化的接口, 用于兼容
+	Handle      Handle        //增加一个简化的接口, 用于兼容
+	Retry       *RetryPolicy  //覆盖Ctrl.Retry
+	Attempts    int           //已执行次数
+	Priority    Priority      //队列内的优先级, HashExec时同key事件仍按放入顺序执行
+	HandleCtx   HandleCtx     //带context的Handle, 优先于Handle
+	Deadline    time.Time     //最晚完成时间, 零值不限制
+	Timeout     time.Duration //开始执行后的超时, 含重试
+	TTL         time.Duration //在队列中最多等待多久, 超过时不执行; 覆盖Ctrl.TTL
+
+	execType ExecType
+	seq      uint64          //WAL序号, 0 表示未记录
+	cancel   *cancelState    //EventPutWithCancel 的取消状态
+	done     func(err error) //事件结束(执行完/取消/丢弃/合并/被Stop放弃)时回调一次
+
+	rescheduled bool //被熔断器重新调度, 仍计入pending, WAL中的记录也未确认
 }
 
 // Ctrl ...
 type Ctrl struct {
-	Name           string
-	EventChan      []chan *Data
-	ChanBufferSize int64
-	QueueIndex     int
-	mu             sync.Mutex
-	Hash           Hash
+	pending            int64 //已入队未执行完的事件数
+	coalesced          int64 //被合并掉的事件数
+	throttled          int64 //限流等待的总时间(ns)
+	expired            int64 //超过TTL被跳过的事件数
+	Name               string
+	ChanBufferSize     int64
+	QueueIndex         int
+	mu                 sync.Mutex
+	Hash               Hash
+	Retry              *RetryPolicy   //默认重试策略, nil 不重试
+	DeadLetter         DeadLetter     //重试耗尽后的事件去向
+	Overflow           OverflowPolicy //队列满时的处理策略
+	OverflowBufferSize int64          //OverflowSpill 的溢出缓冲区大小, <=0 不限制
+	OnDrop             DropFunc       //被溢出策略丢弃的事件
+	OnPanic            PanicHook      //handle panic时回调, panic同时作为错误进入重试/死信流程
+	Observer           Observer       //事件各阶段的回调, nil 不输出
+	Route              RouteMode      //HashExec 的key到队列的映射方式
+	StarvationLimit    int            //低优先级事件等待时最多连续执行多少个高优先级事件, <=0 取16
+	WAL                *WAL           //持久化日志, nil 只保存在内存
+	Coalesce           bool           //HashExec事件与同key未执行的事件合并, 只执行最新的
+	Merge              MergeFunc      //Coalesce 的合并方式, nil 用新事件替换旧事件
+	BatchHandle        BatchHandle    //非nil时每个队列批量执行事件, 忽略Data.Handle
+	BatchSize          int            //每批最多事件数, <=0 取100
+	BatchWait          time.Duration  //取到第一个事件后最多等待多久凑批
+	WorkStealing       bool           //空闲队列从忙碌队列尾部偷非HashExec事件执行
+	RateLimit          RateLimit      //整个Ctrl的执行速率
+	QueueRateLimit     RateLimit      //每个队列的执行速率
+	KeyRateLimit       RateLimit      //每个Data.Key的执行速率
+	KeyLimitSize       int            //保存key令牌桶的LRU大小, <=0 取10000
+	KeyConcurrency     int            //KeyExec事件同时执行的key数上限, <=0 取队列数
+	Autoscale          *Autoscale     //非nil时按负载为每个队列增减执行非HashExec事件的worker
+	Middleware         []Middleware   //按顺序包装每次handle调用, 第一个在最外层; BatchHandle 不经过
+	Breaker            *Breaker       //非nil时每个事件执行前经过熔断器, 打开时按Breaker.Mode处理; BatchHandle 不经过
+	TTL                time.Duration  //事件在队列中最多等待多久(从最近一次放入开始算), 超过时不执行, <=0 不限制
+	OnExpire           ExpireFunc     //超过TTL被跳过的事件, 不进入死信流程
+
+	// Deprecated: 只为兼容保留, 请使用EventPut, 队列数用QueueCount. 直接发送到EventChan[i]的事件
+	// 会原样转发到第i个队列(不经过路由); 设为nil时Run不启动转发goroutine
+	EventChan []chan *Data
+
+	queues     []*queue
+	delay      *scheduler   //EventPutAfter/EventPutAt 的延迟事件, 第一次使用时创建
+	keys       *keyExecutor //KeyExec事件, 第一个KeyExec事件入队时创建
+	limiter    *limiter     //Run时按限流配置创建, nil 不限流
+	keysPaused bool         //PauseAll之后创建的keys也是暂停的, 由putMu保护
+
+	resizeMu sync.Mutex      //Resize串行执行
+	moving   []chan struct{} //上一次Resize换走的key, 都关闭之前下一次Resize先等待
+
+	runCtx    context.Context //handle的父context, Stop超时时取消
+	runCancel context.CancelFunc
+	stopping  chan struct{}  //Stop开始时关闭
+	forwarder sync.WaitGroup //EventChan的转发goroutine
+	queueMu   sync.RWMutex   //保护queues, Resize时独占
+	putMu     sync.RWMutex   //保护isRun/closed
+	isRun     bool
+	closed    bool
+	wg        sync.WaitGroup
 }
 
 // DefaultHash ...
@@ -43,12 +122,15 @@ func DefaultHash(k string) int {
 }
 
 // NewData ...
-func NewData(key string, data any, handle Handle) *Data {
+func NewData(key string, data any, handle Handle, opts ...DataOption) *Data {
 	eventData := &Data{
 		Data:   data,
 		Key:    key,
 		Handle: handle,
 	}
+	for _, opt := range opts {
+		opt(eventData)
+	}
 	return eventData
 }
 
@@ -56,7 +138,10 @@ func NewData(key string, data any, handle Handle) *Data {
 func (c *Ctrl) GetQueueIndexByHash(key string) int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	ret := c.Hash(key) % len(c.EventChan)
+	if c.Route == RouteJump {
+		return JumpHash(uint64(uint32(c.Hash(key))), len(c.queues))
+	}
+	ret := c.Hash(key) % len(c.queues)
 	return ret
 }
 
@@ -65,55 +150,390 @@ func (c *Ctrl) GetQueueIndexByRR() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	ret := c.QueueIndex
-	c.QueueIndex = (c.QueueIndex + 1) % len(c.EventChan)
+	c.QueueIndex = (c.QueueIndex + 1) % len(c.queues)
 	return ret
 }
 
 // EventPut ....
 func (c *Ctrl) EventPut(data *Data, execType ExecType) bool {
+	return c.put(context.Background(), data, execType, true) == nil
+}
+
+// TryPut is EventPut without blocking: when the queue is full and the overflow policy is
+// OverflowBlock it returns a *QueueFullError at once
+func (c *Ctrl) TryPut(data *Data, execType ExecType) error {
+	return c.put(context.Background(), data, execType, false)
+}
+
+// PutWithTimeout is EventPut that gives up with ctx.Err() when ctx expires while waiting for room
+func (c *Ctrl) PutWithTimeout(ctx context.Context, data *Data, execType ExecType) error {
+	return c.put(ctx, data, execType, true)
+}
+
+// put ...
+func (c *Ctrl) put(ctx context.Context, data *Data, execType ExecType, block bool) error {
 	if data == nil {
-		return false
+		return ErrNilData
+	}
+	c.putMu.RLock()
+	closed, isRun, keys := c.closed, c.isRun, c.keys
+	c.putMu.RUnlock()
+	if closed {
+		return ErrClosed
 	}
+	if !isRun {
+		return ErrNotRunning
+	}
+	if execType == KeyExec && keys == nil {
+		if err := c.startKeys(); err != nil {
+			return err
+		}
+	}
+	return c.enqueue(ctx, data, execType, block)
+}
+
+// enqueue 路由并放入队列, 不检查closed
+func (c *Ctrl) enqueue(ctx context.Context, data *Data, execType ExecType, block bool) error {
+	//持有读锁直到入队完成, 保证Resize时没有按旧队列数路由的事件
+	c.queueMu.RLock()
+	defer c.queueMu.RUnlock()
 	switch execType {
 	case HashExec:
 		data.QueueIndex = c.GetQueueIndexByHash(data.Key)
 	case RRExec:
 		data.QueueIndex = c.GetQueueIndexByRR()
+	case LeastLoadedExec:
+		data.QueueIndex = c.getQueueIndexByLoad()
+	case P2CExec:
+		data.QueueIndex = c.getQueueIndexByP2C()
+	case KeyExec:
+		data.QueueIndex = -1
+	case chanExec:
+		data.QueueIndex %= len(c.queues)
+		execType = RRExec
 	}
-	data.InQueueTime = time.Now()
-	//log in queue time
-	log.Printf("EventData in :%+v", data.Data)
+	data.execType = execType
+	//被熔断器重新调度的事件已经计入pending和WAL, 保留最初的入队时间
+	rescheduled := data.rescheduled
+	data.rescheduled = false
+	if !rescheduled {
+		data.InQueueTime = time.Now()
+		if c.WAL != nil {
+			if err := c.WAL.append(data); err != nil {
+				return err
+			}
+		}
+		atomic.AddInt64(&c.pending, 1)
+	}
+	var dropped, replaced *Data
+	var err error
+	if execType == KeyExec {
+		err = c.keys.push(data)
+	} else {
+		opts := pushOptions{
+			policy:       c.Overflow,
+			overflowSize: int(c.OverflowBufferSize),
+			block:        block,
+			coalesce:     c.Coalesce,
+			merge:        c.Merge,
+		}
+		if c.WAL != nil {
+			opts.relog = c.WAL.relog
+		}
+		dropped, replaced, err = c.queues[data.QueueIndex].push(ctx, data, opts)
+	}
+	if dropped != nil {
+		c.drop(dropped)
+	}
+	if replaced != nil {
+		replaced.complete(ErrCoalesced)
+		c.ack(replaced)
+		atomic.AddInt64(&c.pending, -1)
+		atomic.AddInt64(&c.coalesced, 1)
+	}
+	if err != nil && dropped != data && !rescheduled {
+		c.ack(data)
+		atomic.AddInt64(&c.pending, -1)
+	}
+	if err == nil && c.Observer != nil {
+		c.Observer.OnEnqueue(c.Name, data)
+	}
+	if err == nil && execType != HashExec && execType != KeyExec && c.autoscaled() && c.Autoscale.MaxBacklog > 0 {
+		c.scaleUp(c.queues[data.QueueIndex], ScaleUpBacklog)
+	}
+	var full *QueueFullError
+	if errors.As(err, &full) {
+		full.Name = c.Name
+	}
+	return err
+}
 
-	c.EventChan[data.QueueIndex] <- data
-	return true
+// ack ...
+func (c *Ctrl) ack(data *Data) {
+	if c.WAL != nil {
+		c.WAL.ack(data)
+	}
+}
+
+// drop ...
+func (c *Ctrl) drop(data *Data) {
+	data.complete(ErrDropped)
+	c.ack(data)
+	atomic.AddInt64(&c.pending, -1)
+	if c.OnDrop != nil {
+		c.OnDrop(data, c.Overflow)
+	}
 }
 
 // run ...
-func (c *Ctrl) run(data chan *Data) {
+func (c *Ctrl) run(q *queue) {
+	defer c.wg.Done()
+	defer q.elastic.Wait()
 	for {
-		e := <-data
+		e, ok := c.next(q)
+		if !ok {
+			return
+		}
 		if e == nil {
 			continue
 		}
-		//log in queue => out queue time
-		execStart := time.Now()
-		log.Printf("EventData ExecStart:%+v, wait cost:%fs", e.Data, execStart.Sub(e.InQueueTime).Seconds())
-		if e.Handle != nil {
-			e.Handle(e.Data)
+		if c.autoscaled() && c.Autoscale.MaxWait > 0 && time.Since(e.InQueueTime) >= c.Autoscale.MaxWait {
+			c.scaleUp(q, ScaleUpWait)
 		}
-		//log out queue => exec end time
-		execEnd := time.Now()
-		log.Printf("EventData ExecEnd:%+v, exec cost:%fs", e.Data, execEnd.Sub(execStart).Seconds())
+		c.execute(q, e)
 	}
 }
 
+// execute 执行从q取出的事件
+func (c *Ctrl) execute(q *queue, e *Data) {
+	c.throttle(e)
+	ran := &Data{Key: e.Key, execType: e.execType} //被熔断器重新调度时e可能已经再次入队
+	err := c.exec(e)
+	if err != errRescheduled {
+		e.complete(err)
+	}
+	q.finish(ran)
+	if err == errRescheduled {
+		return
+	}
+	c.ack(e)
+	atomic.AddInt64(&c.pending, -1)
+}
+
+// exec 返回事件最终的错误, 开始前已被取消时返回 context.Canceled, 等待超过TTL时返回 ErrExpired,
+// 被熔断器重新调度时返回 errRescheduled
+func (c *Ctrl) exec(e *Data) (err error) {
+	if !canceledByCaller(e) && c.expire(e) {
+		if e.cancel != nil {
+			e.cancel.finish()
+		}
+		return ErrExpired
+	}
+	if c.Breaker != nil {
+		if err := c.admit(e); err != nil {
+			return err
+		}
+		defer func() {
+			if canceledByCaller(e) {
+				c.Breaker.release()
+				return
+			}
+			c.Breaker.record(err)
+		}()
+	}
+	ctx, cancel, ok := c.eventContext(e)
+	if !ok {
+		return context.Canceled
+	}
+	defer cancel()
+	if e.cancel != nil {
+		defer e.cancel.finish()
+	}
+	observer := c.Observer
+	if observer == nil {
+		return c.handle(ctx, e)
+	}
+	//in queue => out queue time
+	execStart := time.Now()
+	wait := execStart.Sub(e.InQueueTime)
+	observer.OnDequeue(c.Name, e, wait)
+	observer.OnExecStart(c.Name, e, wait)
+	err = c.handle(ctx, e)
+	//out queue => exec end time
+	observer.OnExecEnd(c.Name, e, wait, time.Since(execStart), err)
+	return err
+}
+
 // Run ...
 func (c *Ctrl) Run() {
-	for i := 0; i < len(c.EventChan); i++ {
-		c.EventChan[i] = make(chan *Data, c.ChanBufferSize)
-		log.Printf("evenChan[%d]:bufferSize:[%d]", i, c.ChanBufferSize)
-		go c.run(c.EventChan[i])
+	c.putMu.Lock()
+	defer c.putMu.Unlock()
+	if c.isRun || c.closed {
+		return
+	}
+	c.limiter = newLimiter(c)
+	c.runCtx, c.runCancel = context.WithCancel(context.Background())
+	c.stopping = make(chan struct{})
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	for i := 0; i < len(c.queues); i++ {
+		c.startQueue(i)
+	}
+	c.startForwarders()
+	c.isRun = true
+	if c.WAL != nil {
+		c.replay()
+	}
+}
+
+// replay 把WAL中未确认的事件放回原队列, 在任何新的EventPut之前执行; must be called with c.queueMu held
+func (c *Ctrl) replay() {
+	for _, e := range c.WAL.recover() {
+		if e.execType == KeyExec {
+			e.InQueueTime = time.Now()
+			atomic.AddInt64(&c.pending, 1)
+			if c.keys == nil {
+				c.newKeys()
+			}
+			c.keys.push(e)
+			if c.Observer != nil {
+				c.Observer.OnEnqueue(c.Name, e)
+			}
+			continue
+		}
+		//HashExec事件按当前队列数重新路由, 与新放入的同key事件在同一队列
+		if keyed(e) || e.QueueIndex < 0 || e.QueueIndex >= len(c.queues) {
+			e.QueueIndex = c.GetQueueIndexByHash(e.Key)
+		}
+		e.InQueueTime = time.Now()
+		atomic.AddInt64(&c.pending, 1)
+		//恢复的事件不受溢出策略影响, 也不等待worker腾出空间: 这时还持有putMu, 而handle可能正在等它
+		if _, _, err := c.queues[e.QueueIndex].push(context.Background(), e, pushOptions{policy: OverflowSpill}); err != nil {
+			atomic.AddInt64(&c.pending, -1)
+			continue
+		}
+		if c.Observer != nil {
+			c.Observer.OnEnqueue(c.Name, e)
+		}
+	}
+}
+
+// startQueue must be called with c.queueMu held
+func (c *Ctrl) startQueue(i int) {
+	c.queues[i] = newQueue(i, c.ChanBufferSize, c.StarvationLimit)
+	c.wg.Add(1)
+	if c.BatchHandle != nil {
+		go c.runBatch(c.queues[i])
+		return
+	}
+	go c.run(c.queues[i])
+}
+
+// QueueCount ...
+func (c *Ctrl) QueueCount() int {
+	c.queueMu.RLock()
+	defer c.queueMu.RUnlock()
+	return len(c.queues)
+}
+
+// QueueLen returns the number of events buffered in the queue, the running one excluded
+func (c *Ctrl) QueueLen(queueIndex int) int {
+	c.putMu.RLock()
+	isRun := c.isRun
+	c.putMu.RUnlock()
+	c.queueMu.RLock()
+	defer c.queueMu.RUnlock()
+	if !isRun || queueIndex < 0 || queueIndex >= len(c.queues) {
+		return 0
+	}
+	return c.queues[queueIndex].len()
+}
+
+// Pending returns the number of events that were put but have not finished yet
+func (c *Ctrl) Pending() int {
+	return int(atomic.LoadInt64(&c.pending))
+}
+
+// Drain waits until every event put so far has been handled, EventPut keeps working meanwhile
+func (c *Ctrl) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollPeriod)
+	defer ticker.Stop()
+	for c.Pending() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Stop rejects further EventPut calls, lets every queue handle its buffered events and waits for the
+// running handles to return. Delayed events that are not due yet are discarded and counted as
+// abandoned. If ctx expires first, the events still buffered are discarded as well and the count is
+// returned together with ctx.Err(); handles that are already running are left to finish and their
+// context is canceled.
+func (c *Ctrl) Stop(ctx context.Context) (int, error) {
+	c.putMu.Lock()
+	if c.closed {
+		c.putMu.Unlock()
+		return 0, ErrClosed
+	}
+	c.closed = true
+	if !c.isRun {
+		c.putMu.Unlock()
+		return 0, nil
+	}
+	close(c.stopping)
+	abandoned := 0
+	if c.delay != nil {
+		abandoned = c.delay.close()
+	}
+	keys := c.keys //closed之后不会再创建
+	c.putMu.Unlock()
+	c.forwarder.Wait()
+	c.queueMu.RLock()
+	for _, q := range c.queues {
+		q.close()
+	}
+	c.queueMu.RUnlock()
+	if keys != nil {
+		keys.close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		c.runCancel()
+		return abandoned, nil
+	case <-ctx.Done():
+	}
+	//超时: 丢弃还在缓冲区中的事件, 已被worker取走的事件视为执行中并取消其context
+	c.runCancel()
+	c.queueMu.RLock()
+	defer c.queueMu.RUnlock()
+	for _, q := range c.queues {
+		for _, e := range q.clear() {
+			if e == nil {
+				continue
+			}
+			e.complete(ErrClosed)
+			abandoned++
+			atomic.AddInt64(&c.pending, -1)
+		}
+	}
+	if keys != nil {
+		for _, e := range keys.clear() {
+			e.complete(ErrClosed)
+			abandoned++
+			atomic.AddInt64(&c.pending, -1)
+		}
 	}
+	return abandoned, ctx.Err()
 }
 
 // NewCtrl ...
@@ -121,6 +541,7 @@ func NewCtrl(name string, queueCount int, chanBufferSize int64, hash Hash) *Ctrl
 	ctrl := &Ctrl{
 		Name:           name,
 		EventChan:      make([]chan *Data, queueCount),
+		queues:         make([]*queue, queueCount),
 		ChanBufferSize: chanBufferSize,
 		QueueIndex:     0,
 		Hash:           hash,
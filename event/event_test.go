@@ -1,11 +1,15 @@
 package event
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
 	"time"
 )
 
-func ExampleEventPut() {
+func ExampleCtrl_EventPut() {
 	ctrl := NewCtrl("test1", 10, 256, DefaultHash)
 	ctrl.Run()
 	for i := 0; i < 20; i++ {
@@ -20,3 +24,89 @@ func ExampleEventPut() {
 	fmt.Println("a")
 	//OutPut:a
 }
+
+func TestCtrlStop(t *testing.T) {
+	ctrl := NewCtrl("stop", 4, 16, DefaultHash)
+	ctrl.Run()
+	var handled int64
+	for i := 0; i < 20; i++ {
+		ctrl.EventPut(NewData(fmt.Sprintf("key:%d", i), i, func(data any) error {
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&handled, 1)
+			return nil
+		}), HashExec)
+	}
+	abandoned, err := ctrl.Stop(context.Background())
+	if err != nil || abandoned != 0 {
+		t.Fatalf("Stop() = %d, %v, want 0, nil", abandoned, err)
+	}
+	if atomic.LoadInt64(&handled) != 20 {
+		t.Errorf("handled = %d, want 20", handled)
+	}
+	if ctrl.EventPut(NewData("late", nil, nil), RRExec) {
+		t.Errorf("EventPut() after Stop = true, want false")
+	}
+	if _, err := ctrl.Stop(context.Background()); err != ErrClosed {
+		t.Errorf("second Stop() err = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestCtrlStopTimeout(t *testing.T) {
+	ctrl := NewCtrl("stop-timeout", 1, 16, DefaultHash)
+	ctrl.Run()
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		ctrl.EventPut(NewData("key", i, func(data any) error {
+			<-release
+			return nil
+		}), HashExec)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	abandoned, err := ctrl.Stop(ctx)
+	close(release)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Stop() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	//第一个事件已在执行, 其余4个被丢弃
+	if abandoned != 4 {
+		t.Errorf("Stop() abandoned = %d, want 4", abandoned)
+	}
+}
+
+func TestCtrlDrain(t *testing.T) {
+	ctrl := NewCtrl("drain", 2, 16, DefaultHash)
+	ctrl.Run()
+	var handled int64
+	for i := 0; i < 10; i++ {
+		ctrl.EventPut(NewData("", i, func(data any) error {
+			atomic.AddInt64(&handled, 1)
+			return nil
+		}), RRExec)
+	}
+	if err := ctrl.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() err = %v", err)
+	}
+	if atomic.LoadInt64(&handled) != 10 || ctrl.Pending() != 0 {
+		t.Errorf("handled = %d, pending = %d, want 10, 0", handled, ctrl.Pending())
+	}
+}
+
+func TestCtrlEventChan(t *testing.T) {
+	ctrl := NewCtrl("compat", 2, 16, DefaultHash)
+	ctrl.Run()
+	var mu sync.Mutex
+	var got []int
+	for i := 0; i < 4; i++ {
+		ctrl.EventChan[1] <- NewData("", i, func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, data.(int))
+			return nil
+		})
+	}
+	ctrl.Stop(context.Background())
+	if len(got) != 4 || got[0] != 0 || got[3] != 3 {
+		t.Errorf("events sent to EventChan ran %v, want [0 1 2 3]", got)
+	}
+}
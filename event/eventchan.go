@@ -0,0 +1,45 @@
+package event
+
+import "context"
+
+// chanExec 兼容EventChan: 使用data.QueueIndex指定的队列
+const chanExec ExecType = -1
+
+// startForwarders must be called with c.putMu held
+func (c *Ctrl) startForwarders() {
+	for i := range c.EventChan {
+		c.EventChan[i] = make(chan *Data, c.ChanBufferSize)
+		c.forwarder.Add(1)
+		go c.forward(i, c.EventChan[i])
+	}
+}
+
+// forward 把发送到EventChan[i]的事件放入第i个队列, Stop开始后转发完通道中剩余的事件再退出
+func (c *Ctrl) forward(i int, ch chan *Data) {
+	defer c.forwarder.Done()
+	for {
+		select {
+		case e := <-ch:
+			c.forwardData(i, e)
+		case <-c.stopping:
+			for {
+				select {
+				case e := <-ch:
+					c.forwardData(i, e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *Ctrl) forwardData(i int, e *Data) {
+	if e == nil {
+		return
+	}
+	e.QueueIndex = i
+	if err := c.enqueue(context.Background(), e, chanExec, true); err != nil {
+		e.complete(err)
+	}
+}
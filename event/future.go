@@ -0,0 +1,58 @@
+package event
+
+import "context"
+
+// Future is the result of an event put by EventCall
+type Future[R any] struct {
+	done  chan struct{}
+	value R
+	err   error
+}
+
+// Done is closed once the result is available
+func (f *Future[R]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait returns the value and error of the handle, or ctx.Err() if ctx ends first. The error is
+// context.Canceled, ErrDropped, ErrCoalesced, ErrExpired or ErrClosed when the handle did not run.
+func (f *Future[R]) Wait(ctx context.Context) (R, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero R
+		return zero, ctx.Err()
+	}
+}
+
+// EventCall puts an event whose handle returns a value, e.g. applying an update to the account of
+// key and returning the new balance, and returns a Future for that value. With HashExec the calls
+// of a key run one by one in put order. Retries and the dead-letter path apply as for EventPut, the
+// value is the one of the last attempt.
+func EventCall[R any](c *Ctrl, key string, data any, handle func(ctx context.Context, data any) (R, error), execType ExecType, opts ...DataOption) (*Future[R], error) {
+	f := &Future[R]{done: make(chan struct{})}
+	e := NewDataCtx(key, data, func(ctx context.Context, data any) error {
+		value, err := handle(ctx, data)
+		f.value = value
+		return err
+	}, opts...)
+	e.done = func(err error) {
+		f.err = err
+		close(f.done)
+	}
+	if err := c.put(context.Background(), e, execType, true); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// complete 事件结束时调用一次done
+func (e *Data) complete(err error) {
+	if e.done == nil {
+		return
+	}
+	done := e.done
+	e.done = nil
+	done(err)
+}
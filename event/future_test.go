@@ -0,0 +1,71 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventCall(t *testing.T) {
+	ctrl := NewCtrl("future", 4, 64, DefaultHash)
+	ctrl.Run()
+	balance := map[string]int{}
+	deposit := func(ctx context.Context, data any) (int, error) {
+		d := data.([2]any)
+		account, amount := d[0].(string), d[1].(int)
+		if balance[account]+amount < 0 {
+			return balance[account], errTest
+		}
+		balance[account] += amount
+		return balance[account], nil
+	}
+	var futures []*Future[int]
+	for _, amount := range []int{10, 20, -50, 5} {
+		f, err := EventCall(ctrl, "acct", [2]any{"acct", amount}, deposit, HashExec)
+		if err != nil {
+			t.Fatalf("EventCall() err = %v", err)
+		}
+		futures = append(futures, f)
+	}
+	wants := []struct {
+		value int
+		err   error
+	}{{10, nil}, {30, nil}, {30, errTest}, {35, nil}}
+	for i, f := range futures {
+		value, err := f.Wait(context.Background())
+		if value != wants[i].value || !errors.Is(err, wants[i].err) {
+			t.Errorf("future %d Wait() = %d, %v, want %d, %v", i, value, err, wants[i].value, wants[i].err)
+		}
+	}
+	ctrl.Stop(context.Background())
+}
+
+func TestEventCallNotRun(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 16)
+	ctrl.Coalesce = true
+	call := func(key string) *Future[string] {
+		f, _ := EventCall(ctrl, key, key, func(ctx context.Context, data any) (string, error) {
+			return data.(string), nil
+		}, HashExec)
+		return f
+	}
+	replaced, latest := call("a"), call("a")
+	abandoned := call("b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := abandoned.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait() before run err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := replaced.Wait(context.Background()); err != ErrCoalesced {
+		t.Errorf("replaced Wait() err = %v, want %v", err, ErrCoalesced)
+	}
+	ctrl.Stop(ctx)
+	close(release)
+	for _, f := range []*Future[string]{latest, abandoned} {
+		if _, err := f.Wait(context.Background()); err != ErrClosed {
+			t.Errorf("abandoned Wait() err = %v, want %v", err, ErrClosed)
+		}
+	}
+}
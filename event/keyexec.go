@@ -0,0 +1,232 @@
+package event
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// lane 一个key的待执行事件, FIFO
+type lane struct {
+	key     string
+	items   []*Data
+	running bool //有worker正在执行该key的事件
+}
+
+// keyExecutor KeyExec事件的执行器: 每个有事件的key一条lane, 就绪的lane按FIFO轮流交给worker,
+// 同一lane同时只有一个worker, lane空闲后立即删除. 不限长度, 不经过溢出策略/优先级/合并/批量执行
+type keyExecutor struct {
+	mu     sync.Mutex
+	lanes  map[string]*lane //有待执行或执行中事件的key
+	ready  []*lane          //有待执行事件且没有worker在执行的lane
+	closed bool
+	paused bool          //PauseAll时不再交出事件, close后不再生效
+	notify chan struct{} //状态变化时关闭, 供阻塞的pop等待
+}
+
+func newKeyExecutor() *keyExecutor {
+	return &keyExecutor{lanes: make(map[string]*lane)}
+}
+
+// waitChan must be called with k.mu held
+func (k *keyExecutor) waitChan() <-chan struct{} {
+	if k.notify == nil {
+		k.notify = make(chan struct{})
+	}
+	return k.notify
+}
+
+// broadcast must be called with k.mu held
+func (k *keyExecutor) broadcast() {
+	if k.notify != nil {
+		close(k.notify)
+		k.notify = nil
+	}
+}
+
+// push ...
+func (k *keyExecutor) push(e *Data) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrClosed
+	}
+	l, ok := k.lanes[e.Key]
+	if !ok {
+		l = &lane{key: e.Key}
+		k.lanes[e.Key] = l
+	}
+	l.items = append(l.items, e)
+	if !l.running && len(l.items) == 1 {
+		k.ready = append(k.ready, l)
+		k.broadcast()
+	}
+	return nil
+}
+
+// pop 取出下一个就绪lane的第一个事件, 队列关闭且没有事件时返回false
+func (k *keyExecutor) pop() (*lane, *Data, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for {
+		for (!k.paused || k.closed) && len(k.ready) > 0 {
+			l := k.ready[0]
+			k.ready[0] = nil
+			k.ready = k.ready[1:]
+			e := l.items[0]
+			l.items[0] = nil
+			l.items = l.items[1:]
+			l.running = true
+			return l, e, true
+		}
+		if k.closed {
+			return nil, nil, false
+		}
+		wait := k.waitChan()
+		k.mu.Unlock()
+		<-wait
+		k.mu.Lock()
+	}
+}
+
+// finish 事件执行完, lane还有事件时重新排到就绪队列末尾, 否则删除
+func (k *keyExecutor) finish(l *lane) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	l.running = false
+	if len(l.items) == 0 {
+		delete(k.lanes, l.key)
+		k.broadcast()
+		return
+	}
+	k.ready = append(k.ready, l)
+	k.broadcast()
+}
+
+// remove 移除还未执行的e
+func (k *keyExecutor) remove(e *Data) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	l, ok := k.lanes[e.Key]
+	if !ok {
+		return false
+	}
+	for i, item := range l.items {
+		if item == e {
+			l.items = append(l.items[:i], l.items[i+1:]...)
+			if len(l.items) == 0 && !l.running {
+				//lane空了, 从就绪队列中去掉, 否则同key的下一个事件会再次把它排进去
+				for j, r := range k.ready {
+					if r == l {
+						k.ready = append(k.ready[:j], k.ready[j+1:]...)
+						break
+					}
+				}
+				delete(k.lanes, l.key)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// pause ...
+func (k *keyExecutor) pause(paused bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.paused = paused
+	k.broadcast()
+}
+
+// keys returns the number of keys with waiting or running events
+func (k *keyExecutor) keys() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.lanes)
+}
+
+// close 不再接受新事件, worker执行完剩余事件后退出
+func (k *keyExecutor) close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.closed = true
+	k.broadcast()
+}
+
+// clear 取出所有待执行的事件
+func (k *keyExecutor) clear() []*Data {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var events []*Data
+	for key, l := range k.lanes {
+		events = append(events, l.items...)
+		l.items = nil
+		if !l.running {
+			delete(k.lanes, key)
+		}
+	}
+	k.ready = nil
+	k.broadcast()
+	return events
+}
+
+// startKeys 第一个KeyExec事件入队前创建执行器, 没有KeyExec事件的Ctrl不启动它的worker
+func (c *Ctrl) startKeys() error {
+	c.putMu.Lock()
+	defer c.putMu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if c.keys == nil {
+		c.queueMu.RLock()
+		c.newKeys()
+		c.queueMu.RUnlock()
+	}
+	return nil
+}
+
+// newKeys must be called with c.putMu and c.queueMu held
+func (c *Ctrl) newKeys() {
+	c.keys = newKeyExecutor()
+	c.keys.paused = c.keysPaused
+	workers := c.KeyConcurrency
+	if workers <= 0 {
+		workers = len(c.queues)
+	}
+	c.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go c.runKeys(c.keys)
+	}
+}
+
+// runKeys KeyExec的worker
+func (c *Ctrl) runKeys(k *keyExecutor) {
+	defer c.wg.Done()
+	for {
+		l, e, ok := k.pop()
+		if !ok {
+			return
+		}
+		c.throttle(e)
+		err := c.exec(e)
+		if err != errRescheduled {
+			e.complete(err)
+		}
+		k.finish(l)
+		if err == errRescheduled {
+			continue
+		}
+		c.ack(e)
+		atomic.AddInt64(&c.pending, -1)
+	}
+}
+
+// ActiveKeys returns the number of keys that have KeyExec events waiting or running. The state of
+// a key is dropped as soon as its last event finishes.
+func (c *Ctrl) ActiveKeys() int {
+	c.putMu.RLock()
+	defer c.putMu.RUnlock()
+	if c.keys == nil {
+		return 0
+	}
+	return c.keys.keys()
+}
@@ -0,0 +1,142 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyExec(t *testing.T) {
+	ctrl := NewCtrl("keys", 1, 1, DefaultHash)
+	ctrl.KeyConcurrency = 4
+	ctrl.Run()
+	var mu sync.Mutex
+	got := map[string][]int{}
+	var running, maxRunning int64
+	for i := 0; i < 20; i++ {
+		for k := 0; k < 8; k++ {
+			key := fmt.Sprintf("k%d", k)
+			ctrl.EventPut(NewData(key, i, func(data any) error {
+				n := atomic.AddInt64(&running, 1)
+				defer atomic.AddInt64(&running, -1)
+				mu.Lock()
+				if n > maxRunning {
+					maxRunning = n
+				}
+				got[key] = append(got[key], data.(int))
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				return nil
+			}), KeyExec)
+		}
+	}
+	if err := ctrl.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() err = %v", err)
+	}
+	for key, values := range got {
+		for i, v := range values {
+			if v != i {
+				t.Fatalf("key %s ran %v, want put order", key, values)
+			}
+		}
+	}
+	if len(got) != 8 || maxRunning != 4 {
+		t.Errorf("ran %d keys with up to %d at once, want 8 keys with up to 4", len(got), maxRunning)
+	}
+	if n := ctrl.ActiveKeys(); n != 0 {
+		t.Errorf("ActiveKeys() after Drain = %d, want 0", n)
+	}
+	ctrl.Stop(context.Background())
+}
+
+func TestKeyExecNoHeadOfLineBlocking(t *testing.T) {
+	ctrl := NewCtrl("keys", 1, 1, DefaultHash)
+	ctrl.KeyConcurrency = 2
+	ctrl.Run()
+	release := make(chan struct{})
+	ctrl.EventPut(NewData("slow", nil, func(data any) error {
+		<-release
+		return nil
+	}), KeyExec)
+	ctrl.EventPut(NewData("slow", nil, nil), KeyExec)
+	done := make(chan struct{})
+	ctrl.EventPut(NewData("fast", nil, func(data any) error {
+		close(done)
+		return nil
+	}), KeyExec)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("event of another key blocked behind slow key")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := ctrl.ActiveKeys(); n != 1 {
+		t.Errorf("ActiveKeys() = %d, want 1", n)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	abandoned, err := ctrl.Stop(ctx)
+	close(release)
+	if abandoned != 1 || err != context.DeadlineExceeded {
+		t.Errorf("Stop() = %d, %v, want 1, %v", abandoned, err, context.DeadlineExceeded)
+	}
+}
+
+func TestKeyExecLazy(t *testing.T) {
+	ctrl := NewCtrl("keys-lazy", 2, 16, DefaultHash)
+	ctrl.Run()
+	if ctrl.keys != nil {
+		t.Fatalf("keys created before the first KeyExec event")
+	}
+	done := make(chan struct{})
+	ctrl.EventPut(NewData("k", nil, func(data any) error {
+		close(done)
+		return nil
+	}), KeyExec)
+	<-done
+	ctrl.Stop(context.Background())
+
+	//从没有KeyExec事件的Ctrl, Stop之后也不再创建
+	ctrl = NewCtrl("keys-lazy", 2, 16, DefaultHash)
+	ctrl.Run()
+	ctrl.Stop(context.Background())
+	if err := ctrl.TryPut(NewData("k", nil, nil), KeyExec); err != ErrClosed || ctrl.keys != nil {
+		t.Errorf("TryPut() after Stop err = %v, keys = %v, want %v, nil", err, ctrl.keys, ErrClosed)
+	}
+}
+
+func TestKeyExecCancelReady(t *testing.T) {
+	ctrl := NewCtrl("keys-cancel", 1, 1, DefaultHash)
+	ctrl.KeyConcurrency = 2
+	ctrl.Run()
+	defer ctrl.Stop(context.Background())
+	ctrl.PauseAll()
+	cancel, _ := ctrl.EventPutWithCancel(NewData("k", nil, nil), KeyExec)
+	cancel()
+	//取消清空了就绪的lane, 之后同key的事件不能让它再次就绪
+	var running, maxRunning int64
+	for i := 0; i < 2; i++ {
+		ctrl.EventPut(NewData("k", nil, func(data any) error {
+			n := atomic.AddInt64(&running, 1)
+			defer atomic.AddInt64(&running, -1)
+			for {
+				m := atomic.LoadInt64(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}), KeyExec)
+	}
+	ctrl.ResumeAll()
+	if err := ctrl.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain() err = %v", err)
+	}
+	if maxRunning != 1 {
+		t.Errorf("ran up to %d events of the same key at once, want 1", maxRunning)
+	}
+}
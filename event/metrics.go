@@ -0,0 +1,237 @@
+package event
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the latency histogram upper bounds in seconds
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricKey struct {
+	ctrl  string
+	queue int
+}
+
+type histogram struct {
+	counts []uint64 //与buckets一一对应, 非累计
+	count  uint64
+	sum    float64
+}
+
+type queueMetrics struct {
+	enqueued      uint64
+	errors        uint64
+	panics        uint64
+	attempts      uint64 //Metrics.Middleware 记录的每次执行
+	attemptErrors uint64
+	throttle      float64 //秒
+	wait          histogram
+	exec          histogram
+	attempt       histogram
+}
+
+// Metrics collects per queue counters and latency histograms of the Ctrls it observes and
+// renders them in the Prometheus text exposition format
+type Metrics struct {
+	NopObserver
+	Buckets []float64 //直方图上界(秒), 需在Register前设置, nil 使用DefaultBuckets
+
+	mu     sync.Mutex
+	queues map[metricKey]*queueMetrics
+	ctrls  []*Ctrl
+}
+
+// NewMetrics ...
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Buckets: DefaultBuckets,
+		queues:  make(map[metricKey]*queueMetrics),
+	}
+}
+
+// Register adds ctrl to the collector and chains the collector into ctrl.Observer, call it before ctrl.Run
+func (m *Metrics) Register(ctrl *Ctrl) {
+	m.mu.Lock()
+	m.ctrls = append(m.ctrls, ctrl)
+	m.mu.Unlock()
+	if ctrl.Observer == nil {
+		ctrl.Observer = m
+		return
+	}
+	ctrl.Observer = MultiObserver(ctrl.Observer, m)
+}
+
+// get must be called with m.mu held
+func (m *Metrics) get(name string, queueIndex int) *queueMetrics {
+	key := metricKey{ctrl: name, queue: queueIndex}
+	q, ok := m.queues[key]
+	if !ok {
+		q = &queueMetrics{
+			wait:    histogram{counts: make([]uint64, len(m.buckets()))},
+			exec:    histogram{counts: make([]uint64, len(m.buckets()))},
+			attempt: histogram{counts: make([]uint64, len(m.buckets()))},
+		}
+		m.queues[key] = q
+	}
+	return q
+}
+
+func (m *Metrics) buckets() []float64 {
+	if m.Buckets == nil {
+		return DefaultBuckets
+	}
+	return m.Buckets
+}
+
+func (m *Metrics) observe(h *histogram, d time.Duration) {
+	v := d.Seconds()
+	for i, bound := range m.buckets() {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (m *Metrics) OnEnqueue(name string, data *Data) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(name, data.QueueIndex).enqueued++
+}
+
+func (m *Metrics) OnExecEnd(name string, data *Data, wait, exec time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.get(name, data.QueueIndex)
+	m.observe(&q.wait, wait)
+	m.observe(&q.exec, exec)
+	if err != nil {
+		q.errors++
+	}
+}
+
+// OnPanic implements PanicObserver
+func (m *Metrics) OnPanic(name string, data *Data, err *PanicError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(name, data.QueueIndex).panics++
+}
+
+// OnThrottle implements ThrottleObserver
+func (m *Metrics) OnThrottle(name string, data *Data, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(name, data.QueueIndex).throttle += wait.Seconds()
+}
+
+// ServeHTTP ...
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Write renders all metrics in the Prometheus text exposition format
+func (m *Metrics) Write(w io.Writer) error {
+	//队列深度要拿Ctrl的锁, 在m.mu之外读, 否则与持有queueMu调用OnEnqueue的EventPut死锁
+	m.mu.Lock()
+	ctrls := append([]*Ctrl(nil), m.ctrls...)
+	m.mu.Unlock()
+	depth := make(map[metricKey]int)
+	for _, ctrl := range ctrls {
+		for i := 0; i < ctrl.QueueCount(); i++ {
+			depth[metricKey{ctrl: ctrl.Name, queue: i}] += ctrl.QueueLen(i)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range depth {
+		m.get(key.ctrl, key.queue)
+	}
+	keys := make([]metricKey, 0, len(m.queues))
+	for key := range m.queues {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ctrl != keys[j].ctrl {
+			return keys[i].ctrl < keys[j].ctrl
+		}
+		return keys[i].queue < keys[j].queue
+	})
+
+	bw := bufio.NewWriter(w)
+	header(bw, "event_queue_depth", "gauge", "Number of events buffered in the queue.")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "event_queue_depth%s %d\n", key.labels(""), depth[key])
+	}
+	counters := []struct {
+		name, help string
+		value      func(q *queueMetrics) uint64
+	}{
+		{"event_enqueued_total", "Number of events put into the queue.", func(q *queueMetrics) uint64 { return q.enqueued }},
+		{"event_errors_total", "Number of events whose handle finally failed.", func(q *queueMetrics) uint64 { return q.errors }},
+		{"event_panics_total", "Number of handle panics.", func(q *queueMetrics) uint64 { return q.panics }},
+		{"event_attempts_total", "Number of handle attempts seen by Metrics.Middleware.", func(q *queueMetrics) uint64 { return q.attempts }},
+		{"event_attempt_errors_total", "Number of failed handle attempts seen by Metrics.Middleware.", func(q *queueMetrics) uint64 { return q.attemptErrors }},
+	}
+	for _, counter := range counters {
+		header(bw, counter.name, "counter", counter.help)
+		for _, key := range keys {
+			fmt.Fprintf(bw, "%s%s %d\n", counter.name, key.labels(""), counter.value(m.queues[key]))
+		}
+	}
+	header(bw, "event_throttled_seconds_total", "counter", "Time events were delayed by the rate limits.")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "event_throttled_seconds_total%s %s\n", key.labels(""), strconv.FormatFloat(m.queues[key].throttle, 'g', -1, 64))
+	}
+	header(bw, "event_wait_seconds", "histogram", "Time events waited in the queue before execution.")
+	for _, key := range keys {
+		m.writeHistogram(bw, "event_wait_seconds", key, &m.queues[key].wait)
+	}
+	header(bw, "event_exec_seconds", "histogram", "Time spent executing event handles, retries included.")
+	for _, key := range keys {
+		m.writeHistogram(bw, "event_exec_seconds", key, &m.queues[key].exec)
+	}
+	header(bw, "event_attempt_seconds", "histogram", "Time spent in each handle attempt seen by Metrics.Middleware.")
+	for _, key := range keys {
+		m.writeHistogram(bw, "event_attempt_seconds", key, &m.queues[key].attempt)
+	}
+	return bw.Flush()
+}
+
+func (m *Metrics) writeHistogram(w io.Writer, name string, key metricKey, h *histogram) {
+	var cumulative uint64
+	for i, bound := range m.buckets() {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, key.labels(strconv.FormatFloat(bound, 'g', -1, 64)), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, key.labels("+Inf"), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, key.labels(""), strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, key.labels(""), h.count)
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels le 为空时不输出le标签
+func (k metricKey) labels(le string) string {
+	s := fmt.Sprintf(`{ctrl="%s",queue="%d"`, labelEscaper.Replace(k.ctrl), k.queue)
+	if le != "" {
+		s += fmt.Sprintf(`,le="%s"`, le)
+	}
+	return s + "}"
+}
@@ -0,0 +1,84 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.Buckets = []float64{0.5, 1}
+	ctrl := NewCtrl(`order"s`, 2, 16, DefaultHash)
+	metrics.Register(ctrl)
+	ctrl.Run()
+	ctrl.EventPut(NewData("", nil, func(data any) error { return nil }), RRExec)
+	ctrl.EventPut(NewData("", nil, func(data any) error { panic("boom") }), RRExec)
+	ctrl.EventPut(NewData("", nil, func(data any) error { return errTest }), RRExec)
+	ctrl.Stop(context.Background())
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+	wants := []string{
+		"# TYPE event_queue_depth gauge\n",
+		`event_queue_depth{ctrl="order\"s",queue="1"} 0` + "\n",
+		`event_enqueued_total{ctrl="order\"s",queue="0"} 2` + "\n",
+		`event_errors_total{ctrl="order\"s",queue="0"} 1` + "\n",
+		`event_panics_total{ctrl="order\"s",queue="1"} 1` + "\n",
+		"# TYPE event_exec_seconds histogram\n",
+		`event_wait_seconds_bucket{ctrl="order\"s",queue="0",le="0.5"} 2` + "\n",
+		`event_exec_seconds_bucket{ctrl="order\"s",queue="1",le="+Inf"} 1` + "\n",
+		`event_exec_seconds_count{ctrl="order\"s",queue="0"} 2` + "\n",
+	}
+	for _, want := range wants {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsWriteResize(t *testing.T) {
+	m := NewMetrics()
+	ctrl := NewCtrl("metrics-resize", 2, 16, DefaultHash)
+	m.Register(ctrl)
+	ctrl.Run()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(3)
+	loop := func(f func(i int)) {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			f(i)
+		}
+	}
+	go loop(func(i int) { ctrl.EventPut(NewData(fmt.Sprint(i), i, func(data any) error { return nil }), HashExec) })
+	go loop(func(i int) { m.Write(io.Discard) })
+	go loop(func(i int) { ctrl.Resize(context.Background(), 1+i%3) })
+	time.Sleep(100 * time.Millisecond)
+	close(done)
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("EventPut, Write and Resize deadlocked")
+	}
+	ctrl.Stop(context.Background())
+}
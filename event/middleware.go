@@ -0,0 +1,109 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Middleware wraps the handle of every event of a Ctrl, e.g. to add tracing or inject an auth
+// context. It is applied to each attempt, so retries go through it again.
+type Middleware func(next HandleCtx) HandleCtx
+
+type dataKey struct{}
+
+// DataFromContext returns the event being handled, for middlewares that need its Key or Attempts
+func DataFromContext(ctx context.Context) *Data {
+	e, _ := ctx.Value(dataKey{}).(*Data)
+	return e
+}
+
+// chain 按Ctrl.Middleware的顺序包装h, 第一个在最外层
+func (c *Ctrl) chain(h HandleCtx) HandleCtx {
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		h = c.Middleware[i](h)
+	}
+	return h
+}
+
+// TimeoutMiddleware limits each attempt to d, the handle must watch ctx for it to take effect
+func TimeoutMiddleware(d time.Duration) Middleware {
+	return func(next HandleCtx) HandleCtx {
+		return func(ctx context.Context, data any) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, data)
+		}
+	}
+}
+
+// RecoverMiddleware turns a panic of the handle into a *PanicError inside the chain, so that the
+// middlewares in front of it see the failure. hook may be nil. Ctrl.OnPanic and PanicObserver are
+// not called for the panics it recovers.
+func RecoverMiddleware(hook PanicHook) Middleware {
+	return func(next HandleCtx) HandleCtx {
+		return func(ctx context.Context, data any) (err error) {
+			defer recoverPanic(&err, func(p *PanicError) {
+				if hook != nil {
+					hook(DataFromContext(ctx), p)
+				}
+			})
+			return next(ctx, data)
+		}
+	}
+}
+
+// LogMiddleware logs every attempt to logger, nil uses the standard log. LogDebug also logs the
+// start of the attempts, LogError only the failed ones.
+func LogMiddleware(level LogLevel, logger *log.Logger) Middleware {
+	printf := log.Printf
+	if logger != nil {
+		printf = logger.Printf
+	}
+	return func(next HandleCtx) HandleCtx {
+		return func(ctx context.Context, data any) error {
+			//不在Ctrl中执行时没有事件, 不输出queue/key
+			where := ""
+			if e := DataFromContext(ctx); e != nil {
+				where = fmt.Sprintf(" queue:%d, key:%s, attempt:%d,", e.QueueIndex, e.Key, e.Attempts)
+			}
+			if level <= LogDebug {
+				printf("EventData attempt start%s", strings.TrimSuffix(where, ","))
+			}
+			start := time.Now()
+			err := next(ctx, data)
+			if level <= LogInfo || err != nil {
+				printf("EventData attempt end%s cost:%fs, err:%v", where, time.Since(start).Seconds(), err)
+			}
+			return err
+		}
+	}
+}
+
+// Middleware returns a Middleware that records every attempt of the Ctrl named name into
+// event_attempts_total, event_attempt_errors_total and event_attempt_seconds
+func (m *Metrics) Middleware(name string) Middleware {
+	return func(next HandleCtx) HandleCtx {
+		return func(ctx context.Context, data any) error {
+			start := time.Now()
+			err := next(ctx, data)
+			exec := time.Since(start)
+			//不在Ctrl中执行时与KeyExec事件一样记在queue -1
+			queueIndex := -1
+			if e := DataFromContext(ctx); e != nil {
+				queueIndex = e.QueueIndex
+			}
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			q := m.get(name, queueIndex)
+			q.attempts++
+			if err != nil {
+				q.attemptErrors++
+			}
+			m.observe(&q.attempt, exec)
+			return err
+		}
+	}
+}
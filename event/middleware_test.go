@@ -0,0 +1,109 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	ctrl := NewCtrl("middleware", 1, 16, DefaultHash)
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next HandleCtx) HandleCtx {
+			return func(ctx context.Context, data any) error {
+				calls = append(calls, name+">"+DataFromContext(ctx).Key)
+				err := next(ctx, data)
+				calls = append(calls, "<"+name)
+				return err
+			}
+		}
+	}
+	ctrl.Middleware = []Middleware{trace("a"), trace("b")}
+	ctrl.Run()
+	ctrl.EventPut(NewData("k", nil, func(data any) error {
+		calls = append(calls, "handle")
+		return nil
+	}), HashExec)
+	ctrl.Stop(context.Background())
+	want := "a>k b>k handle <b <a"
+	if got := strings.Join(calls, " "); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+}
+
+func TestBundledMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	var recovered []*PanicError
+	metrics := NewMetrics()
+	ctrl := NewCtrl("bundled", 1, 16, DefaultHash)
+	metrics.Register(ctrl)
+	ctrl.Retry = &RetryPolicy{MaxAttempts: 2}
+	ctrl.Middleware = []Middleware{
+		metrics.Middleware(ctrl.Name),
+		LogMiddleware(LogError, log.New(&buf, "", 0)),
+		RecoverMiddleware(func(data *Data, err *PanicError) {
+			mu.Lock()
+			defer mu.Unlock()
+			recovered = append(recovered, err)
+		}),
+		TimeoutMiddleware(10 * time.Millisecond),
+	}
+	errs := make(chan error, 2)
+	ctrl.DeadLetter = func(data *Data, err error, attempts int) { errs <- err }
+	ctrl.Run()
+	ctrl.EventPut(NewDataCtx("slow", nil, func(ctx context.Context, data any) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), HashExec)
+	ctrl.EventPut(NewData("panic", nil, func(data any) error { panic("boom") }), HashExec)
+	ctrl.EventPut(NewData("ok", nil, func(data any) error { return nil }), HashExec)
+	ctrl.Stop(context.Background())
+
+	if err := <-errs; err != context.DeadlineExceeded {
+		t.Errorf("slow event err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	var p *PanicError
+	if err := <-errs; !errors.As(err, &p) || len(recovered) != 2 {
+		t.Errorf("panic event err = %v with %d recovered, want *PanicError recovered twice", err, len(recovered))
+	}
+	if n := strings.Count(buf.String(), "attempt end"); n != 4 {
+		t.Errorf("logged %d failed attempts, want 4:\n%s", n, buf.String())
+	}
+	var out bytes.Buffer
+	metrics.Write(&out)
+	for _, want := range []string{
+		`event_attempts_total{ctrl="bundled",queue="0"} 5`,
+		`event_attempt_errors_total{ctrl="bundled",queue="0"} 4`,
+		`event_attempt_seconds_count{ctrl="bundled",queue="0"} 5`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics missing %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestMiddlewareWithoutCtrl(t *testing.T) {
+	var buf bytes.Buffer
+	metrics := NewMetrics()
+	h := func(ctx context.Context, data any) error { return errors.New("fail") }
+	h = LogMiddleware(LogDebug, log.New(&buf, "", 0))(h)
+	h = metrics.Middleware("bare")(h)
+	if err := h(context.Background(), nil); err == nil {
+		t.Fatalf("handle err = nil, want fail")
+	}
+	if got, want := buf.String(), "EventData attempt start\nEventData attempt end cost:"; !strings.HasPrefix(got, want) {
+		t.Errorf("logged %q, want prefix %q", got, want)
+	}
+	var out bytes.Buffer
+	metrics.Write(&out)
+	if want := `event_attempt_errors_total{ctrl="bare",queue="-1"} 1`; !strings.Contains(out.String(), want) {
+		t.Errorf("metrics missing %q, got:\n%s", want, out.String())
+	}
+}
@@ -0,0 +1,145 @@
+package event
+
+import (
+	"log"
+	"time"
+)
+
+// Observer is notified of every step of an event, the callbacks run on the producer (OnEnqueue)
+// or the queue goroutine (the others) and must not block
+type Observer interface {
+	OnEnqueue(name string, data *Data)
+	OnDequeue(name string, data *Data, wait time.Duration)
+	OnExecStart(name string, data *Data, wait time.Duration)
+	OnExecEnd(name string, data *Data, wait, exec time.Duration, err error)
+}
+
+// NopObserver ignores everything, embed it to implement only part of Observer
+type NopObserver struct{}
+
+func (NopObserver) OnEnqueue(string, *Data)                                      {}
+func (NopObserver) OnDequeue(string, *Data, time.Duration)                       {}
+func (NopObserver) OnExecStart(string, *Data, time.Duration)                     {}
+func (NopObserver) OnExecEnd(string, *Data, time.Duration, time.Duration, error) {}
+
+type multiObserver []Observer
+
+// MultiObserver fans every callback out to observers in order
+func MultiObserver(observers ...Observer) Observer {
+	return multiObserver(observers)
+}
+
+func (m multiObserver) OnEnqueue(name string, data *Data) {
+	for _, o := range m {
+		o.OnEnqueue(name, data)
+	}
+}
+
+func (m multiObserver) OnDequeue(name string, data *Data, wait time.Duration) {
+	for _, o := range m {
+		o.OnDequeue(name, data, wait)
+	}
+}
+
+func (m multiObserver) OnExecStart(name string, data *Data, wait time.Duration) {
+	for _, o := range m {
+		o.OnExecStart(name, data, wait)
+	}
+}
+
+// OnPanic implements PanicObserver
+func (m multiObserver) OnPanic(name string, data *Data, err *PanicError) {
+	for _, o := range m {
+		if p, ok := o.(PanicObserver); ok {
+			p.OnPanic(name, data, err)
+		}
+	}
+}
+
+// OnThrottle implements ThrottleObserver
+func (m multiObserver) OnThrottle(name string, data *Data, wait time.Duration) {
+	for _, o := range m {
+		if t, ok := o.(ThrottleObserver); ok {
+			t.OnThrottle(name, data, wait)
+		}
+	}
+}
+
+// OnScale implements ScaleObserver
+func (m multiObserver) OnScale(name string, queueIndex, workers int, reason ScaleReason) {
+	for _, o := range m {
+		if s, ok := o.(ScaleObserver); ok {
+			s.OnScale(name, queueIndex, workers, reason)
+		}
+	}
+}
+
+func (m multiObserver) OnExecEnd(name string, data *Data, wait, exec time.Duration, err error) {
+	for _, o := range m {
+		o.OnExecEnd(name, data, wait, exec, err)
+	}
+}
+
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota //记录入队/出队/执行开始/执行结束
+	LogInfo                  //只记录执行结束
+	LogError                 //只记录执行失败
+)
+
+// LogObserver writes events to a log.Logger
+type LogObserver struct {
+	Level  LogLevel
+	Logger *log.Logger        //nil 使用标准log
+	Redact func(data any) any //输出前对payload脱敏, nil 时不输出payload
+}
+
+// NewLogObserver ...
+func NewLogObserver(level LogLevel) *LogObserver {
+	return &LogObserver{Level: level}
+}
+
+func (l *LogObserver) printf(format string, v ...any) {
+	if l.Logger != nil {
+		l.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func (l *LogObserver) payload(data *Data) any {
+	if l.Redact == nil {
+		return "-"
+	}
+	return l.Redact(data.Data)
+}
+
+func (l *LogObserver) OnEnqueue(name string, data *Data) {
+	if l.Level > LogDebug {
+		return
+	}
+	l.printf("EventData in ctrl:%s, queue:%d, key:%s, data:%+v", name, data.QueueIndex, data.Key, l.payload(data))
+}
+
+func (l *LogObserver) OnDequeue(name string, data *Data, wait time.Duration) {
+	if l.Level > LogDebug {
+		return
+	}
+	l.printf("EventData out ctrl:%s, queue:%d, key:%s, wait cost:%fs", name, data.QueueIndex, data.Key, wait.Seconds())
+}
+
+func (l *LogObserver) OnExecStart(name string, data *Data, wait time.Duration) {
+	if l.Level > LogDebug {
+		return
+	}
+	l.printf("EventData ExecStart ctrl:%s, queue:%d, key:%s, data:%+v, wait cost:%fs", name, data.QueueIndex, data.Key, l.payload(data), wait.Seconds())
+}
+
+func (l *LogObserver) OnExecEnd(name string, data *Data, wait, exec time.Duration, err error) {
+	if l.Level > LogInfo && err == nil {
+		return
+	}
+	l.printf("EventData ExecEnd ctrl:%s, queue:%d, key:%s, data:%+v, wait cost:%fs, exec cost:%fs, attempts:%d, err:%v",
+		name, data.QueueIndex, data.Key, l.payload(data), wait.Seconds(), exec.Seconds(), data.Attempts, err)
+}
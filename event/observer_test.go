@@ -0,0 +1,68 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordObserver struct {
+	NopObserver
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recordObserver) record(step string, data *Data) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, fmt.Sprintf("%s:%v", step, data.Data))
+}
+
+func (r *recordObserver) OnExecStart(name string, data *Data, wait time.Duration) {
+	r.record("start", data)
+}
+
+func (r *recordObserver) OnExecEnd(name string, data *Data, wait, exec time.Duration, err error) {
+	r.record(fmt.Sprintf("end(%v)", err), data)
+}
+
+func TestCtrlObserver(t *testing.T) {
+	ctrl := NewCtrl("observer", 1, 16, DefaultHash)
+	observer := &recordObserver{}
+	ctrl.Observer = MultiObserver(observer)
+	ctrl.Run()
+	ctrl.EventPut(NewData("", 1, func(data any) error { return nil }), RRExec)
+	ctrl.EventPut(NewData("", 2, func(data any) error { return errTest }), RRExec)
+	ctrl.Stop(context.Background())
+	want := "[start:1 end(<nil>):1 start:2 end(test error):2]"
+	if got := fmt.Sprint(observer.steps); got != want {
+		t.Errorf("steps = %s, want %s", got, want)
+	}
+}
+
+func TestLogObserver(t *testing.T) {
+	var buf bytes.Buffer
+	observer := NewLogObserver(LogInfo)
+	observer.Logger = log.New(&buf, "", 0)
+	data := NewData("user:1", "password=secret", nil)
+
+	observer.OnEnqueue("ctrl", data)
+	observer.OnExecEnd("ctrl", data, time.Second, time.Second, nil)
+	if got := buf.String(); strings.Contains(got, "secret") || strings.Count(got, "\n") != 1 {
+		t.Errorf("LogInfo output = %q, want one line without payload", got)
+	}
+
+	buf.Reset()
+	observer.Level = LogError
+	observer.Redact = func(data any) any { return strings.Split(data.(string), "=")[0] }
+	observer.OnExecEnd("ctrl", data, time.Second, time.Second, nil)
+	observer.OnExecEnd("ctrl", data, time.Second, time.Second, errTest)
+	if got := buf.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, "data:password,") {
+		t.Errorf("LogError output = %q, want one redacted line", got)
+	}
+}
@@ -0,0 +1,40 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+)
+
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota //阻塞等待队列有空间
+	OverflowReject                           //返回 *QueueFullError
+	OverflowDropNewest                       //丢弃新放入的事件
+	OverflowDropOldest                       //丢弃队列中最早的事件
+	OverflowSpill                            //写入溢出缓冲区, 大小为 Ctrl.OverflowBufferSize
+)
+
+var (
+	ErrQueueFull = errors.New("event: queue full")
+	ErrDropped   = errors.New("event: dropped by overflow policy")
+)
+
+// QueueFullError ...
+type QueueFullError struct {
+	Name       string
+	QueueIndex int
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("event: ctrl %s queue[%d] full", e.Name, e.QueueIndex)
+}
+
+// Is reports whether target is ErrQueueFull
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrQueueFull
+}
+
+// DropFunc receives the events discarded by OverflowDropNewest or OverflowDropOldest, and the
+// delayed events refused by OverflowReject when they are due
+type DropFunc func(data *Data, policy OverflowPolicy)
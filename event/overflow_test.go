@@ -0,0 +1,101 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newBlockedCtrl 返回单队列的Ctrl, 其worker阻塞在第一个事件上直到release被关闭
+func newBlockedCtrl(t *testing.T, policy OverflowPolicy, bufferSize int64) (*Ctrl, chan struct{}) {
+	ctrl := NewCtrl(t.Name(), 1, bufferSize, DefaultHash)
+	ctrl.Overflow = policy
+	ctrl.Run()
+	started, release := make(chan struct{}), make(chan struct{})
+	ctrl.EventPut(NewData("", -1, func(data any) error {
+		close(started)
+		<-release
+		return nil
+	}), RRExec)
+	<-started
+	return ctrl, release
+}
+
+func TestCtrlTryPut(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 1)
+	defer close(release)
+	if err := ctrl.TryPut(NewData("", 0, nil), RRExec); err != nil {
+		t.Fatalf("TryPut() err = %v, want nil", err)
+	}
+	err := ctrl.TryPut(NewData("", 1, nil), RRExec)
+	var full *QueueFullError
+	if !errors.Is(err, ErrQueueFull) || !errors.As(err, &full) || full.Name != t.Name() {
+		t.Errorf("TryPut() err = %v, want *QueueFullError of %s", err, t.Name())
+	}
+}
+
+func TestCtrlPutWithTimeout(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 1)
+	defer close(release)
+	ctrl.EventPut(NewData("", 0, nil), RRExec)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := ctrl.PutWithTimeout(ctx, NewData("", 1, nil), RRExec); err != context.DeadlineExceeded {
+		t.Errorf("PutWithTimeout() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := ctrl.Pending(); got != 2 {
+		t.Errorf("Pending() = %d, want 2", got)
+	}
+}
+
+func TestCtrlOverflowPolicy(t *testing.T) {
+	cases := []struct {
+		policy  OverflowPolicy
+		wantErr error
+		handled string
+		dropped string
+	}{
+		{OverflowReject, ErrQueueFull, "[-1 0 1]", "[]"},
+		{OverflowDropNewest, ErrDropped, "[-1 0 1]", "[2 3]"},
+		{OverflowDropOldest, nil, "[-1 2 3]", "[0 1]"},
+		{OverflowSpill, nil, "[-1 0 1 2 3]", "[]"},
+	}
+	for _, tc := range cases {
+		ctrl, release := newBlockedCtrl(t, tc.policy, 2)
+		var mu sync.Mutex
+		handled, dropped := []int{-1}, []int{}
+		ctrl.OnDrop = func(data *Data, policy OverflowPolicy) {
+			mu.Lock()
+			defer mu.Unlock()
+			dropped = append(dropped, data.Data.(int))
+		}
+		handle := func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, data.(int))
+			return nil
+		}
+		var err error
+		for i := 0; i < 4; i++ {
+			err = ctrl.TryPut(NewData("", i, handle), RRExec)
+		}
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("policy %d: TryPut() err = %v, want %v", tc.policy, err, tc.wantErr)
+		}
+		close(release)
+		ctrl.Stop(context.Background())
+		if fmt.Sprint(handled) != tc.handled || fmt.Sprint(dropped) != tc.dropped {
+			t.Errorf("policy %d: handled = %v, dropped = %v, want %s, %s", tc.policy, handled, dropped, tc.handled, tc.dropped)
+		}
+	}
+}
+
+func TestCtrlPutNotRunning(t *testing.T) {
+	ctrl := NewCtrl("not-running", 1, 1, DefaultHash)
+	if err := ctrl.TryPut(NewData("", nil, nil), RRExec); err != ErrNotRunning {
+		t.Errorf("TryPut() err = %v, want %v", err, ErrNotRunning)
+	}
+}
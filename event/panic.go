@@ -0,0 +1,63 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error a handle returns when it panics
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("event: handle panic: %v", e.Value)
+}
+
+// PanicHook is called with the recovered value and stack every time a handle panics
+type PanicHook func(data *Data, err *PanicError)
+
+// PanicObserver is an optional interface of Observer to be told about every handle panic
+type PanicObserver interface {
+	OnPanic(name string, data *Data, err *PanicError)
+}
+
+// recoverPanic 必须直接被defer, 把panic恢复为 *PanicError 交给hook并作为err返回
+func recoverPanic(err *error, hook func(p *PanicError)) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	p := &PanicError{Value: r, Stack: debug.Stack()}
+	if hook != nil {
+		hook(p)
+	}
+	*err = p
+}
+
+// panicked 通知OnPanic和PanicObserver
+func (c *Ctrl) panicked(e *Data, p *PanicError) {
+	if c.OnPanic != nil {
+		c.OnPanic(e, p)
+	}
+	if o, ok := c.Observer.(PanicObserver); ok {
+		o.OnPanic(c.Name, e, p)
+	}
+}
+
+// call 执行一次handle, panic被恢复为 *PanicError, 队列goroutine不受影响
+func (c *Ctrl) call(ctx context.Context, e *Data) (err error) {
+	defer recoverPanic(&err, func(p *PanicError) { c.panicked(e, p) })
+	h := e.HandleCtx
+	if h == nil {
+		h = func(ctx context.Context, data any) error {
+			return e.Handle(data)
+		}
+	}
+	if len(c.Middleware) > 0 {
+		h = c.chain(h)
+	}
+	return h(context.WithValue(ctx, dataKey{}, e), e.Data)
+}
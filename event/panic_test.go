@@ -0,0 +1,43 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCtrlPanicIsolation(t *testing.T) {
+	ctrl := NewCtrl("panic", 1, 16, DefaultHash)
+	var hooked, dead int64
+	ctrl.OnPanic = func(data *Data, err *PanicError) {
+		atomic.AddInt64(&hooked, 1)
+		if err.Value != "boom" || !strings.Contains(string(err.Stack), "panic_test.go") {
+			t.Errorf("OnPanic() err = %v, stack %s", err, err.Stack)
+		}
+	}
+	ctrl.DeadLetter = func(data *Data, err error, attempts int) {
+		var p *PanicError
+		if !errors.As(err, &p) {
+			t.Errorf("DeadLetter() err = %v, want *PanicError", err)
+		}
+		atomic.AddInt64(&dead, 1)
+	}
+	ctrl.Run()
+
+	var handled int64
+	for i := 0; i < 3; i++ {
+		ctrl.EventPut(NewData("key", i, func(data any) error {
+			panic("boom")
+		}), HashExec)
+		ctrl.EventPut(NewData("key", i, func(data any) error {
+			atomic.AddInt64(&handled, 1)
+			return nil
+		}), HashExec)
+	}
+	ctrl.Stop(context.Background())
+	if hooked != 3 || dead != 3 || handled != 3 {
+		t.Errorf("hooked = %d, dead = %d, handled = %d, want 3, 3, 3", hooked, dead, handled)
+	}
+}
@@ -0,0 +1,111 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidQueueIndex = errors.New("event: invalid queue index")
+
+// QueueState ...
+type QueueState int
+
+const (
+	QueueRunning QueueState = iota //正常执行
+	QueuePaused                    //继续接收事件, 暂不执行
+	QueueStopped                   //Ctrl未运行或已Stop
+)
+
+func (s QueueState) String() string {
+	switch s {
+	case QueueRunning:
+		return "running"
+	case QueuePaused:
+		return "paused"
+	case QueueStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("QueueState(%d)", int(s))
+}
+
+// Pause stops the workers of the queue from taking events after the running one finishes. EventPut
+// keeps buffering into it under the overflow policy, its events are not stolen by other queues,
+// Drain waits for it to be resumed and keys that Resize moves away from it wait in their new queue
+// until then. Stop resumes every paused queue.
+func (c *Ctrl) Pause(queueIndex int) error {
+	if queueIndex < 0 {
+		return ErrInvalidQueueIndex
+	}
+	return c.setPaused(queueIndex, true)
+}
+
+// Resume undoes Pause
+func (c *Ctrl) Resume(queueIndex int) error {
+	if queueIndex < 0 {
+		return ErrInvalidQueueIndex
+	}
+	return c.setPaused(queueIndex, false)
+}
+
+// PauseAll pauses every queue and the KeyExec events, the queues added later by Resize start running
+func (c *Ctrl) PauseAll() error {
+	return c.setPaused(-1, true)
+}
+
+// ResumeAll resumes every queue and the KeyExec events
+func (c *Ctrl) ResumeAll() error {
+	return c.setPaused(-1, false)
+}
+
+// setPaused queueIndex<0 时作用于所有队列
+func (c *Ctrl) setPaused(queueIndex int, paused bool) error {
+	c.putMu.RLock()
+	closed, isRun := c.closed, c.isRun
+	c.putMu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+	if !isRun {
+		return ErrNotRunning
+	}
+	if queueIndex < 0 {
+		c.pauseKeys(paused)
+	}
+	c.queueMu.RLock()
+	defer c.queueMu.RUnlock()
+	if queueIndex >= len(c.queues) {
+		return ErrInvalidQueueIndex
+	}
+	for i, q := range c.queues {
+		if queueIndex < 0 || i == queueIndex {
+			q.pause(paused)
+		}
+	}
+	return nil
+}
+
+// pauseKeys KeyExec事件没有队列, 只随PauseAll/ResumeAll暂停和恢复
+func (c *Ctrl) pauseKeys(paused bool) {
+	c.putMu.Lock()
+	defer c.putMu.Unlock()
+	c.keysPaused = paused
+	if c.keys != nil {
+		c.keys.pause(paused)
+	}
+}
+
+// QueueState returns QueueStopped when the ctrl is not running or queueIndex is out of range
+func (c *Ctrl) QueueState(queueIndex int) QueueState {
+	c.putMu.RLock()
+	closed, isRun := c.closed, c.isRun
+	c.putMu.RUnlock()
+	c.queueMu.RLock()
+	defer c.queueMu.RUnlock()
+	if closed || !isRun || queueIndex < 0 || queueIndex >= len(c.queues) {
+		return QueueStopped
+	}
+	if c.queues[queueIndex].isPaused() {
+		return QueuePaused
+	}
+	return QueueRunning
+}
@@ -0,0 +1,100 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCtrlPause(t *testing.T) {
+	ctrl := NewCtrl("pause", 2, 16, DefaultHash)
+	if err := ctrl.Pause(0); err != ErrNotRunning {
+		t.Errorf("Pause() before Run err = %v, want %v", err, ErrNotRunning)
+	}
+	ctrl.WorkStealing = true
+	ctrl.Run()
+	if err := ctrl.Pause(2); err != ErrInvalidQueueIndex {
+		t.Errorf("Pause(2) err = %v, want %v", err, ErrInvalidQueueIndex)
+	}
+	ctrl.Pause(0)
+	var mu sync.Mutex
+	ran := map[int][]int{}
+	for i := 0; i < 6; i++ {
+		ctrl.EventPut(NewData("", i, func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			e := data.(int)
+			ran[e%2] = append(ran[e%2], e)
+			return nil
+		}), RRExec)
+	}
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	if len(ran[0]) != 0 || len(ran[1]) != 3 {
+		t.Errorf("ran %v while queue 0 paused, want only queue 1", ran)
+	}
+	mu.Unlock()
+	if s, n := ctrl.QueueState(0), ctrl.QueueLen(0); s != QueuePaused || n != 3 {
+		t.Errorf("queue 0 is %s with %d events, want paused with 3", s, n)
+	}
+	ctrl.Resume(0)
+	ctrl.Drain(context.Background())
+	if s := ctrl.QueueState(0); s != QueueRunning || len(ran[0]) != 3 || ran[0][2] != 4 {
+		t.Errorf("after Resume queue 0 is %s and ran %v, want running and [0 2 4]", s, ran[0])
+	}
+	ctrl.Stop(context.Background())
+}
+
+func TestCtrlPauseAllStop(t *testing.T) {
+	ctrl := NewCtrl("pause", 2, 16, DefaultHash)
+	ctrl.Run()
+	ctrl.PauseAll()
+	ran := 0
+	for i := 0; i < 4; i++ {
+		ctrl.EventPut(NewData("k", i, func(data any) error {
+			ran++
+			return nil
+		}), HashExec)
+	}
+	if n := ctrl.Pending(); n != 4 || ran != 0 {
+		t.Errorf("Pending() = %d with %d run while paused, want 4 with 0", n, ran)
+	}
+	if abandoned, err := ctrl.Stop(context.Background()); abandoned != 0 || err != nil || ran != 4 {
+		t.Errorf("Stop() = %d, %v with %d run, want 0, nil with 4", abandoned, err, ran)
+	}
+	if s := ctrl.QueueState(0); s != QueueStopped {
+		t.Errorf("QueueState() after Stop = %s, want %s", s, QueueStopped)
+	}
+}
+
+func TestCtrlPauseAllKeyExec(t *testing.T) {
+	ctrl := NewCtrl("pause", 2, 16, DefaultHash)
+	ctrl.Run()
+	//PauseAll时还没有KeyExec事件, 之后创建的执行器同样暂停
+	ctrl.PauseAll()
+	var ran int64
+	handle := func(data any) error {
+		atomic.AddInt64(&ran, 1)
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		ctrl.EventPut(NewData("k", i, handle), KeyExec)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ctrl.Drain(ctx); err == nil || atomic.LoadInt64(&ran) != 0 {
+		t.Errorf("Drain() while paused err = %v with %d run, want timeout with 0", err, ran)
+	}
+	ctrl.ResumeAll()
+	ctrl.Drain(context.Background())
+	if n := atomic.LoadInt64(&ran); n != 2 {
+		t.Errorf("ran %d after ResumeAll, want 2", n)
+	}
+	ctrl.PauseAll()
+	ctrl.EventPut(NewData("k", 2, handle), KeyExec)
+	if abandoned, err := ctrl.Stop(context.Background()); abandoned != 0 || err != nil || atomic.LoadInt64(&ran) != 3 {
+		t.Errorf("Stop() = %d, %v with %d run, want 0, nil with 3", abandoned, err, ran)
+	}
+}
@@ -0,0 +1,10 @@
+package event
+
+// Priority 数值越大越先执行, 同优先级FIFO
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
@@ -0,0 +1,64 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCtrlPriority(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 16)
+	var mu sync.Mutex
+	var order []string
+	put := func(key string, priority Priority, execType ExecType) {
+		data := NewData(key, fmt.Sprintf("%s%d", key, priority), func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, data.(string))
+			return nil
+		})
+		data.Priority = priority
+		ctrl.EventPut(data, execType)
+	}
+	put("r", PriorityLow, RRExec)
+	put("a", PriorityNormal, HashExec)
+	put("r", PriorityNormal, RRExec)
+	put("b", PriorityLow, HashExec)
+	//a0 被提升到高优先级, 保证a1不越过它
+	put("a", PriorityHigh, HashExec)
+	put("r", PriorityHigh, RRExec)
+	close(release)
+	ctrl.Stop(context.Background())
+	if got, want := fmt.Sprint(order), "[a0 a1 r1 r0 r-1 b-1]"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestQueueStarvation(t *testing.T) {
+	q := newQueue(0, 100, 2)
+	now := time.Now()
+	push := func(key string, priority Priority, execType ExecType) {
+		data := NewData(key, nil, nil)
+		data.Priority, data.execType = priority, execType
+		data.InQueueTime = now
+		now = now.Add(time.Millisecond)
+		q.push(context.Background(), data, pushOptions{block: true})
+	}
+	push("k", PriorityHigh, HashExec)
+	push("low", PriorityLow, RRExec)
+	push("k", PriorityLow, HashExec)
+	for i := 0; i < 4; i++ {
+		push(fmt.Sprintf("high%d", i), PriorityHigh, RRExec)
+	}
+	var order []string
+	for q.len() > 0 {
+		e, _ := q.pop()
+		order = append(order, fmt.Sprintf("%s%d", e.Key, e.Priority))
+	}
+	//每连续2个高优先级后执行一个等待最久的低优先级事件
+	if got, want := fmt.Sprint(order), "[k1 high01 low-1 high11 high21 k-1 high31]"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,549 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultStarvationLimit = 16
+
+// level 同一优先级的事件, FIFO
+type level struct {
+	priority Priority
+	items    []*Data
+}
+
+// queue 单个事件队列, 对应一个worker goroutine
+type queue struct {
+	index      int
+	capacity   int
+	starvation int //高优先级连续出队次数上限
+	mu         sync.Mutex
+	levels     []*level       //按优先级从高到低
+	size       int            //所有层的事件数
+	keys       map[string]int //HashExec事件各key的待执行数
+	busy       map[string]int //HashExec事件各key的执行中数
+	served     int            //有更低优先级事件等待时, 连续从最高层出队的次数
+	running    int            //已出队还未执行完的事件数
+	unkeyed    int            //非HashExec事件的待执行数
+	workers    int            //Autoscale扩出的worker数, 不含固定的一个
+	elastic    sync.WaitGroup //扩出的worker, 固定的worker退出前等待它们
+	paused     bool           //暂停时worker不取事件, 关闭后忽略
+	closed     bool
+	notify     chan struct{} //状态变化时关闭, 供阻塞的push/pop等待
+
+	moved map[string]*move         //Resize换到其它队列的key, 本队列中该key的事件都结束时释放
+	held  map[string]chan struct{} //Resize从其它队列换来的key, 关闭前不取该key的事件
+}
+
+func newQueue(index int, capacity int64, starvation int) *queue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if starvation <= 0 {
+		starvation = defaultStarvationLimit
+	}
+	return &queue{
+		index:      index,
+		capacity:   int(capacity),
+		starvation: starvation,
+		keys:       make(map[string]int),
+		busy:       make(map[string]int),
+		moved:      make(map[string]*move),
+		held:       make(map[string]chan struct{}),
+	}
+}
+
+// keyed 是否需要保证同key顺序
+func keyed(e *Data) bool {
+	return e.execType == HashExec
+}
+
+// waitChan must be called with q.mu held
+func (q *queue) waitChan() <-chan struct{} {
+	if q.notify == nil {
+		q.notify = make(chan struct{})
+	}
+	return q.notify
+}
+
+// broadcast must be called with q.mu held
+func (q *queue) broadcast() {
+	if q.notify != nil {
+		close(q.notify)
+		q.notify = nil
+	}
+}
+
+// len ...
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// load 待执行与执行中的事件数
+func (q *queue) load() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size + q.running
+}
+
+// finish 标记已出队的事件执行完成
+func (q *queue) finish(events ...*Data) {
+	var released []*queue
+	defer func() { wake(released) }()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running -= len(events)
+	for _, e := range events {
+		if !keyed(e) {
+			continue
+		}
+		if q.busy[e.Key]--; q.busy[e.Key] <= 0 {
+			delete(q.busy, e.Key)
+		}
+		if to := q.leave(e.Key); to != nil {
+			released = append(released, to)
+		}
+	}
+}
+
+// level must be called with q.mu held, 不存在时按优先级插入
+func (q *queue) level(p Priority) *level {
+	i := 0
+	for ; i < len(q.levels); i++ {
+		if q.levels[i].priority == p {
+			return q.levels[i]
+		}
+		if q.levels[i].priority < p {
+			break
+		}
+	}
+	l := &level{priority: p}
+	q.levels = append(q.levels, nil)
+	copy(q.levels[i+1:], q.levels[i:])
+	q.levels[i] = l
+	return l
+}
+
+// add must be called with q.mu held
+func (q *queue) add(e *Data) {
+	if keyed(e) && q.keys[e.Key] > 0 {
+		q.promote(e.Key, e.Priority)
+	}
+	l := q.level(e.Priority)
+	l.items = append(l.items, e)
+	q.size++
+	if keyed(e) {
+		q.keys[e.Key]++
+	} else {
+		q.unkeyed++
+	}
+	q.broadcast()
+}
+
+// promote 把同key中优先级低于p的事件按原顺序移到p层队尾, 使新事件不会越过它们.
+// 同key事件所在层按到达顺序不升, 所以高层在前的遍历顺序就是到达顺序
+func (q *queue) promote(key string, p Priority) {
+	target := q.level(p)
+	for _, l := range q.levels {
+		if l.priority >= p {
+			continue
+		}
+		kept := l.items[:0]
+		for _, item := range l.items {
+			if keyed(item) && item.Key == key {
+				target.items = append(target.items, item)
+			} else {
+				kept = append(kept, item)
+			}
+		}
+		for i := len(kept); i < len(l.items); i++ {
+			l.items[i] = nil
+		}
+		l.items = kept
+	}
+}
+
+// remove must be called with q.mu held
+func (q *queue) remove(li, i int) *Data {
+	l := q.levels[li]
+	e := l.items[i]
+	copy(l.items[i:], l.items[i+1:])
+	l.items[len(l.items)-1] = nil
+	l.items = l.items[:len(l.items)-1]
+	if len(l.items) == 0 {
+		q.levels = append(q.levels[:li], q.levels[li+1:]...)
+	}
+	q.size--
+	if keyed(e) {
+		if q.keys[e.Key]--; q.keys[e.Key] <= 0 {
+			delete(q.keys, e.Key)
+		}
+	} else {
+		q.unkeyed--
+	}
+	q.broadcast()
+	return e
+}
+
+// take must be called with q.mu held and q.ready().
+// 取最高优先级层的队首; 连续served次后改取所有层中等待最久的事件, 避免低优先级饿死.
+// 被Resize挡住的key的事件不算队首
+func (q *queue) take() *Data {
+	q.running++
+	pick := 0
+	for q.head(pick) < 0 {
+		pick++
+	}
+	if len(q.levels) > 1 {
+		q.served++
+		if q.served > q.starvation {
+			q.served = 0
+			for li := pick + 1; li < len(q.levels); li++ {
+				if i := q.head(li); i >= 0 && q.levels[li].items[i].InQueueTime.Before(q.levels[pick].items[q.head(pick)].InQueueTime) {
+					pick = li
+				}
+			}
+		}
+	} else {
+		q.served = 0
+	}
+	i := q.head(pick)
+	e := q.levels[pick].items[i]
+	if pick > 0 && keyed(e) {
+		//同key更早的事件一定在更高的层, 先执行它
+		for li := 0; li < pick; li++ {
+			for i, item := range q.levels[li].items {
+				if keyed(item) && item.Key == e.Key {
+					return q.start(li, i)
+				}
+			}
+		}
+	}
+	return q.start(pick, i)
+}
+
+// start must be called with q.mu held, 取出事件并记为执行中
+func (q *queue) start(li, i int) *Data {
+	e := q.remove(li, i)
+	if keyed(e) {
+		q.busy[e.Key]++
+	}
+	return e
+}
+
+// pushOptions ...
+type pushOptions struct {
+	policy       OverflowPolicy
+	overflowSize int
+	block        bool //为false时队列满不等待
+	coalesce     bool
+	merge        MergeFunc
+	relog        func(*Data) error //开启WAL时记录合并结果
+}
+
+// find must be called with q.mu held, 返回同key最后一个HashExec事件的位置
+func (q *queue) find(key string) (int, int, bool) {
+	if q.keys[key] == 0 {
+		return 0, 0, false
+	}
+	for li := len(q.levels) - 1; li >= 0; li-- {
+		items := q.levels[li].items
+		for i := len(items) - 1; i >= 0; i-- {
+			if keyed(items[i]) && items[i].Key == key {
+				return li, i, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// coalesce must be called with q.mu held, 用e(或合并结果)原地替换同key未执行的事件, 返回被替换的事件
+func (q *queue) coalesce(e *Data, opts pushOptions) (*Data, error) {
+	li, i, ok := q.find(e.Key)
+	if !ok {
+		return nil, nil
+	}
+	pending := q.levels[li].items[i]
+	replaced := *pending //merge可能直接修改pending, 先保留被替换时的状态
+	merged := e
+	if opts.merge != nil {
+		merged = opts.merge(pending, e)
+		merged.Key, merged.QueueIndex, merged.InQueueTime = e.Key, e.QueueIndex, e.InQueueTime
+		merged.execType, merged.seq, merged.cancel, merged.done = e.execType, e.seq, e.cancel, e.done
+		//WAL里只有e的原值, 合并结果要重新记录, 否则重放时丢失合并前的内容
+		if opts.relog != nil {
+			if err := opts.relog(merged); err != nil {
+				*pending = replaced
+				return nil, err
+			}
+		}
+	}
+	q.levels[li].items[i] = merged
+	if merged.Priority > q.levels[li].priority {
+		q.promote(merged.Key, merged.Priority)
+	}
+	q.broadcast()
+	return &replaced, nil
+}
+
+// push 按溢出策略入队, 返回被丢弃的事件和被合并替换的事件(如有)
+func (q *queue) push(ctx context.Context, e *Data, opts pushOptions) (dropped, replaced *Data, err error) {
+	var released *queue
+	defer func() { wake([]*queue{released}) }()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return nil, nil, ErrClosed
+		}
+		if opts.coalesce && keyed(e) {
+			replaced, err := q.coalesce(e, opts)
+			if err != nil || replaced != nil {
+				return nil, replaced, err
+			}
+		}
+		if q.size < q.capacity {
+			q.add(e)
+			return nil, nil, nil
+		}
+		switch opts.policy {
+		case OverflowReject:
+			return nil, nil, &QueueFullError{QueueIndex: q.index}
+		case OverflowDropNewest:
+			return e, nil, ErrDropped
+		case OverflowDropOldest:
+			//丢弃最低优先级层中最早的事件
+			oldest := q.remove(len(q.levels)-1, 0)
+			if keyed(oldest) {
+				released = q.leave(oldest.Key)
+			}
+			q.add(e)
+			return oldest, nil, nil
+		case OverflowSpill:
+			if opts.overflowSize <= 0 || q.size < q.capacity+opts.overflowSize {
+				q.add(e)
+				return nil, nil, nil
+			}
+			return nil, nil, &QueueFullError{QueueIndex: q.index}
+		}
+		if !opts.block {
+			return nil, nil, &QueueFullError{QueueIndex: q.index}
+		}
+		wait := q.waitChan()
+		q.mu.Unlock()
+		select {
+		case <-wait:
+			q.mu.Lock()
+		case <-ctx.Done():
+			q.mu.Lock()
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// ready must be called with q.mu held, 是否有可取的事件
+func (q *queue) ready() bool {
+	if q.size == 0 || (q.paused && !q.closed) {
+		return false
+	}
+	if len(q.held) == 0 {
+		return true
+	}
+	for li := range q.levels {
+		if q.head(li) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// pop 阻塞直到取到事件, 队列关闭且为空时返回false
+func (q *queue) pop() (*Data, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.ready() {
+		if q.closed {
+			return nil, false
+		}
+		wait := q.waitChan()
+		q.mu.Unlock()
+		<-wait
+		q.mu.Lock()
+	}
+	return q.take(), true
+}
+
+// removeData 从队列中移除还未执行的e
+func (q *queue) removeData(e *Data) bool {
+	var released *queue
+	defer func() { wake([]*queue{released}) }()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for li, l := range q.levels {
+		for i, item := range l.items {
+			if item == e {
+				q.remove(li, i)
+				if keyed(e) {
+					released = q.leave(e.Key)
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// popTimeout 同pop, 但最多等待d; 超时返回 nil, true, true
+func (q *queue) popTimeout(d time.Duration) (e *Data, ok bool, timeout bool) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.ready() {
+		if q.closed {
+			return nil, false, false
+		}
+		wait := q.waitChan()
+		q.mu.Unlock()
+		select {
+		case <-wait:
+			q.mu.Lock()
+		case <-timer.C:
+			q.mu.Lock()
+			return nil, true, true
+		}
+	}
+	return q.take(), true, false
+}
+
+// steal 从正在执行事件的队列尾部取走一个非HashExec事件, 从最低优先级开始找
+func (q *queue) steal() *Data {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running == 0 || q.paused {
+		return nil
+	}
+	for li := len(q.levels) - 1; li >= 0; li-- {
+		items := q.levels[li].items
+		for i := len(items) - 1; i >= 0; i-- {
+			if !keyed(items[i]) {
+				return q.remove(li, i)
+			}
+		}
+	}
+	return nil
+}
+
+// adopt 把偷来的事件记为本队列执行中
+func (q *queue) adopt(e *Data) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e.QueueIndex = q.index
+	q.running++
+}
+
+// popUnkeyed 同popTimeout, 但只取非HashExec事件, 从最高优先级开始找; 队列关闭且没有非HashExec事件时返回false
+func (q *queue) popUnkeyed(d time.Duration) (e *Data, ok bool, timeout bool) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.unkeyed == 0 || (q.paused && !q.closed) {
+		if q.closed {
+			return nil, false, false
+		}
+		wait := q.waitChan()
+		q.mu.Unlock()
+		select {
+		case <-wait:
+			q.mu.Lock()
+		case <-timer.C:
+			q.mu.Lock()
+			return nil, true, true
+		}
+	}
+	for li, l := range q.levels {
+		for i, item := range l.items {
+			if !keyed(item) {
+				q.running++
+				return q.remove(li, i), true, false
+			}
+		}
+	}
+	return nil, true, true
+}
+
+// grow 队列未关闭, worker数未到max且非HashExec事件不少于backlog时增加一个worker, 返回调整后的worker数
+func (q *queue) grow(max, backlog int) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || 1+q.workers >= max || q.unkeyed < backlog {
+		return 0, false
+	}
+	q.workers++
+	q.elastic.Add(1)
+	return 1 + q.workers, true
+}
+
+// shrink 减少一个扩出的worker, 返回调整后的worker数
+func (q *queue) shrink() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.workers--
+	return 1 + q.workers
+}
+
+// workerCount 固定的worker加上扩出的worker数
+func (q *queue) workerCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return 1 + q.workers
+}
+
+// pause ...
+func (q *queue) pause(paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = paused
+	q.broadcast()
+}
+
+// isPaused ...
+func (q *queue) isPaused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// close 关闭后不再接收新事件, worker处理完剩余事件后退出
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.broadcast()
+}
+
+// clear 丢弃所有缓冲的事件
+func (q *queue) clear() []*Data {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]*Data, 0, q.size)
+	for _, l := range q.levels {
+		items = append(items, l.items...)
+	}
+	q.levels = nil
+	q.size = 0
+	q.unkeyed = 0
+	q.keys = make(map[string]int)
+	//新队列也被清空了, 不用唤醒
+	for key, m := range q.moved {
+		close(m.done)
+		delete(q.moved, key)
+	}
+	q.broadcast()
+	return items
+}
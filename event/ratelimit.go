@@ -0,0 +1,163 @@
+package event
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultKeyLimitSize = 10000
+
+// RateLimit is a token bucket: Rate tokens per second, at most Burst saved
+type RateLimit struct {
+	Rate  float64 //每秒令牌数, <=0 不限制
+	Burst int     //桶容量, <=0 取1
+}
+
+// ThrottleObserver is an optional interface of Observer to be told how long an event was delayed by the rate limits
+type ThrottleObserver interface {
+	OnThrottle(name string, data *Data, wait time.Duration)
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: limit.Rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve 取一个令牌, 令牌不足时预支, 返回需要等待的时间
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type keyBucket struct {
+	key    string
+	bucket *tokenBucket
+}
+
+// limiter 事件执行前依次从全局/队列/key的令牌桶取令牌, 等待其中最长的时间
+type limiter struct {
+	global *tokenBucket
+	queue  RateLimit
+	key    RateLimit
+	size   int
+
+	mu     sync.Mutex
+	queues map[int]*tokenBucket
+	keys   map[string]*list.Element
+	lru    *list.List //最近使用的在前
+}
+
+func newLimiter(c *Ctrl) *limiter {
+	if c.RateLimit.Rate <= 0 && c.QueueRateLimit.Rate <= 0 && c.KeyRateLimit.Rate <= 0 {
+		return nil
+	}
+	l := &limiter{
+		queue:  c.QueueRateLimit,
+		key:    c.KeyRateLimit,
+		size:   c.KeyLimitSize,
+		queues: make(map[int]*tokenBucket),
+		keys:   make(map[string]*list.Element),
+		lru:    list.New(),
+	}
+	if c.RateLimit.Rate > 0 {
+		l.global = newTokenBucket(c.RateLimit)
+	}
+	if l.size <= 0 {
+		l.size = defaultKeyLimitSize
+	}
+	return l
+}
+
+func (l *limiter) buckets(e *Data) []*tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var buckets []*tokenBucket
+	if l.global != nil {
+		buckets = append(buckets, l.global)
+	}
+	if l.queue.Rate > 0 && e.QueueIndex >= 0 {
+		b, ok := l.queues[e.QueueIndex]
+		if !ok {
+			b = newTokenBucket(l.queue)
+			l.queues[e.QueueIndex] = b
+		}
+		buckets = append(buckets, b)
+	}
+	if l.key.Rate > 0 {
+		if el, ok := l.keys[e.Key]; ok {
+			l.lru.MoveToFront(el)
+			buckets = append(buckets, el.Value.(*keyBucket).bucket)
+		} else {
+			b := newTokenBucket(l.key)
+			l.keys[e.Key] = l.lru.PushFront(&keyBucket{key: e.Key, bucket: b})
+			for l.lru.Len() > l.size {
+				oldest := l.lru.Back()
+				l.lru.Remove(oldest)
+				delete(l.keys, oldest.Value.(*keyBucket).key)
+			}
+			buckets = append(buckets, b)
+		}
+	}
+	return buckets
+}
+
+// wait 等待所有桶的令牌, ctx结束(Stop超时)时不再等待
+func (l *limiter) wait(ctx context.Context, e *Data) time.Duration {
+	now := time.Now()
+	var wait time.Duration
+	for _, b := range l.buckets(e) {
+		if d := b.reserve(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		sleepCtx(ctx, wait)
+	}
+	return wait
+}
+
+// throttle 按限流等待, 不丢弃事件
+func (c *Ctrl) throttle(e *Data) {
+	if c.limiter == nil {
+		return
+	}
+	wait := c.limiter.wait(c.runCtx, e)
+	if wait <= 0 {
+		return
+	}
+	atomic.AddInt64(&c.throttled, int64(wait))
+	if o, ok := c.Observer.(ThrottleObserver); ok {
+		o.OnThrottle(c.Name, e, wait)
+	}
+}
+
+// Throttled returns the total time events were delayed by the rate limits
+func (c *Ctrl) Throttled() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.throttled))
+}
@@ -0,0 +1,72 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(RateLimit{Rate: 10, Burst: 2})
+	now := b.last
+	waits := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, want := range waits {
+		if got := b.reserve(now); got != want {
+			t.Errorf("reserve() #%d = %v, want %v", i, got, want)
+		}
+	}
+	//1秒后补满到Burst, 预支的2个令牌先还上
+	if got := b.reserve(now.Add(time.Second)); got != 0 {
+		t.Errorf("reserve() after refill = %v, want 0", got)
+	}
+}
+
+func TestCtrlKeyRateLimit(t *testing.T) {
+	ctrl := NewCtrl("ratelimit", 4, 16, DefaultHash)
+	ctrl.KeyRateLimit = RateLimit{Rate: 100, Burst: 1}
+	ctrl.Run()
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		ctrl.EventPut(NewData("tenant", i, func(data any) error { return nil }), HashExec)
+		ctrl.EventPut(NewData(fmt.Sprintf("other:%d", i), i, func(data any) error { return nil }), HashExec)
+	}
+	ctrl.Stop(context.Background())
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("elapsed = %v, want >= 40ms for 5 events of one key at 100/s", elapsed)
+	}
+	//每个事件的等待时间在取令牌时计算, 执行耗时会抵扣一部分
+	if got := ctrl.Throttled(); got < 30*time.Millisecond {
+		t.Errorf("Throttled() = %v, want about 40ms", got)
+	}
+}
+
+func TestLimiterKeyLRU(t *testing.T) {
+	l := newLimiter(&Ctrl{KeyRateLimit: RateLimit{Rate: 1}, KeyLimitSize: 2})
+	for _, key := range []string{"a", "b", "a", "c"} {
+		l.buckets(&Data{Key: key})
+	}
+	_, hasA := l.keys["a"]
+	_, hasB := l.keys["b"]
+	if len(l.keys) != 2 || !hasA || hasB {
+		t.Errorf("keys = %v, want a and c", l.keys)
+	}
+}
+
+func TestCtrlRateLimitStop(t *testing.T) {
+	ctrl := NewCtrl("ratelimit-stop", 1, 16, DefaultHash)
+	ctrl.KeyRateLimit = RateLimit{Rate: 1, Burst: 1}
+	ctrl.Run()
+	for i := 0; i < 2; i++ {
+		ctrl.EventPut(NewData("tenant", i, func(data any) error { return nil }), HashExec)
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ctrl.Stop(ctx)
+	//Stop超时后限流等待随context结束, worker不再睡满1秒
+	ctrl.Drain(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Stop() and Drain() took %v, want the throttle wait cut short", elapsed)
+	}
+}
@@ -0,0 +1,187 @@
+package event
+
+import (
+	"context"
+	"errors"
+)
+
+type RouteMode int
+
+const (
+	RouteMod  RouteMode = iota //Hash(key) % 队列数, 队列数变化时几乎所有key都会换队列
+	RouteJump                  //jump consistent hash, 队列数从n变为m时只有约|m-n|/max(m,n)的key换队列
+)
+
+var ErrInvalidQueueCount = errors.New("event: queue count must be positive")
+
+// JumpHash is the jump consistent hash of Lamping and Veach, it maps key to [0, buckets)
+func JumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// Resize changes the number of queues at runtime without waiting for the ctrl to go idle. HashExec
+// keys whose queue changes are held back in their new queue until their events left in the old one
+// have finished, so events of the same key never run concurrently or out of order; other keys, other
+// exec types and KeyExec events keep running. Removed queues handle their buffered events before
+// they stop. A Resize first waits for the keys moved by the previous one, ctx only bounds that wait
+// and nothing is changed if it expires. Use RouteJump to move as few keys as possible.
+func (c *Ctrl) Resize(ctx context.Context, queueCount int) error {
+	if queueCount <= 0 {
+		return ErrInvalidQueueCount
+	}
+	c.resizeMu.Lock()
+	defer c.resizeMu.Unlock()
+	//同一个key只被挡在一处
+	for _, done := range c.moving {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	c.moving = nil
+	//与Run相同的加锁顺序; 持有putMu保证Stop不会在新队列启动前关闭队列
+	c.putMu.RLock()
+	defer c.putMu.RUnlock()
+	if c.closed {
+		return ErrClosed
+	}
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+	if !c.isRun {
+		c.setQueues(make([]*queue, queueCount))
+		return nil
+	}
+	old := c.queues
+	queues := make([]*queue, queueCount)
+	copy(queues, old)
+	c.setQueues(queues)
+	for i := len(old); i < queueCount; i++ {
+		c.startQueue(i)
+	}
+	route := func(key string) *queue {
+		return c.queues[c.GetQueueIndexByHash(key)]
+	}
+	for _, q := range old {
+		c.moving = append(c.moving, q.handOver(route)...)
+	}
+	for i := queueCount; i < len(old); i++ {
+		old[i].close()
+	}
+	return nil
+}
+
+// setQueues must be called with c.queueMu held
+func (c *Ctrl) setQueues(queues []*queue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queues = queues
+	c.QueueIndex = c.QueueIndex % len(queues)
+}
+
+// move 换到其它队列的key
+type move struct {
+	to   *queue
+	done chan struct{} //本队列中该key的事件都结束时关闭
+}
+
+// handOver 把路由变了的key交给新队列, 新队列等本队列中该key的事件(待执行和执行中的)都结束后再取它的事件;
+// 调用时持有c.queueMu, 不会有新的事件入队
+func (q *queue) handOver(route func(key string) *queue) []chan struct{} {
+	q.mu.Lock()
+	var moves []*move
+	var keys []string
+	for _, counts := range []map[string]int{q.keys, q.busy} {
+		for key := range counts {
+			if _, ok := q.moved[key]; ok {
+				continue
+			}
+			to := route(key)
+			if to == q {
+				continue
+			}
+			m := &move{to: to, done: make(chan struct{})}
+			q.moved[key] = m
+			moves = append(moves, m)
+			keys = append(keys, key)
+		}
+	}
+	q.mu.Unlock()
+	fences := make([]chan struct{}, len(moves))
+	for i, m := range moves {
+		//这期间m.done可能已经关闭, 新队列取事件时会忽略它
+		m.to.hold(keys[i], m.done)
+		fences[i] = m.done
+	}
+	return fences
+}
+
+// leave must be called with q.mu held, key被换走且本队列中已没有它的事件时释放, 返回需要唤醒的新队列
+func (q *queue) leave(key string) *queue {
+	m, ok := q.moved[key]
+	if !ok || q.keys[key] > 0 || q.busy[key] > 0 {
+		return nil
+	}
+	delete(q.moved, key)
+	close(m.done)
+	return m.to
+}
+
+// hold 在done关闭之前不取key的事件
+func (q *queue) hold(key string, done chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.held[key] = done
+}
+
+// blocked must be called with q.mu held, e的key是否还被挡着
+func (q *queue) blocked(e *Data) bool {
+	if !keyed(e) {
+		return false
+	}
+	done, ok := q.held[e.Key]
+	if !ok {
+		return false
+	}
+	select {
+	case <-done:
+		delete(q.held, e.Key)
+		return false
+	default:
+		return true
+	}
+}
+
+// head must be called with q.mu held, 第li层第一个没被挡住的事件的位置, 没有时返回-1
+func (q *queue) head(li int) int {
+	if li >= len(q.levels) {
+		return -1
+	}
+	if len(q.held) == 0 {
+		return 0
+	}
+	for i, e := range q.levels[li].items {
+		if !q.blocked(e) {
+			return i
+		}
+	}
+	return -1
+}
+
+// wake 被挡住的key释放后唤醒新队列的worker
+func wake(queues []*queue) {
+	for _, q := range queues {
+		if q == nil {
+			continue
+		}
+		q.mu.Lock()
+		q.broadcast()
+		q.mu.Unlock()
+	}
+}
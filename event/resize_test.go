@@ -0,0 +1,177 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJumpHash(t *testing.T) {
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		key := uint64(DefaultHash(fmt.Sprintf("key:%d", i)))
+		b9, b10 := JumpHash(key, 9), JumpHash(key, 10)
+		if b9 < 0 || b9 >= 9 || b10 < 0 || b10 >= 10 {
+			t.Fatalf("JumpHash() = %d, %d out of range", b9, b10)
+		}
+		if b9 != b10 {
+			if b10 != 9 {
+				t.Fatalf("key moved from %d to %d, want only moves to the new bucket 9", b9, b10)
+			}
+			moved++
+		}
+	}
+	//约1/10的key移动到新队列
+	if moved < 800 || moved > 1200 {
+		t.Errorf("moved = %d, want about 1000", moved)
+	}
+}
+
+func TestCtrlResize(t *testing.T) {
+	ctrl := NewCtrl("resize", 2, 64, DefaultHash)
+	ctrl.Route = RouteJump
+	ctrl.Run()
+
+	var mu sync.Mutex
+	last := map[string]int{}
+	put := func(key string, i int) {
+		ctrl.EventPut(NewData(key, i, func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if last[key] != i-1 {
+				t.Errorf("key %s: event %d ran out of order, last %d", key, i, last[key])
+			}
+			last[key] = i
+			return nil
+		}), HashExec)
+	}
+
+	var wg sync.WaitGroup
+	for k := 0; k < 8; k++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for i := 1; i <= 100; i++ {
+				put(key, i)
+			}
+		}(fmt.Sprintf("key:%d", k))
+	}
+	for _, n := range []int{5, 1, 3} {
+		if err := ctrl.Resize(context.Background(), n); err != nil {
+			t.Fatalf("Resize(%d) err = %v", n, err)
+		}
+		if got := ctrl.QueueCount(); got != n {
+			t.Errorf("QueueCount() = %d, want %d", got, n)
+		}
+	}
+	wg.Wait()
+	ctrl.Stop(context.Background())
+	for key, i := range last {
+		if i != 100 {
+			t.Errorf("key %s: last = %d, want 100", key, i)
+		}
+	}
+	if err := ctrl.Resize(context.Background(), 0); err != ErrInvalidQueueCount {
+		t.Errorf("Resize(0) err = %v, want %v", err, ErrInvalidQueueCount)
+	}
+}
+
+// movingKey 返回队列数从from变为to时换队列的key
+func movingKey(ctrl *Ctrl, from, to int) string {
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if h := ctrl.Hash(key); h%from != h%to {
+			return key
+		}
+	}
+}
+
+func TestCtrlResizeBusy(t *testing.T) {
+	ctrl := NewCtrl("resize", 2, 64, DefaultHash)
+	ctrl.Run()
+	key := movingKey(ctrl, 2, 4)
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) Handle {
+		return func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	ctrl.EventPut(NewData(key, nil, func(data any) error {
+		close(started)
+		<-release
+		return record("a")(data)
+	}), HashExec)
+	ctrl.EventPut(NewData(key, nil, record("b")), HashExec)
+	<-started
+	//有事件在执行时也立即换队列
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ctrl.Resize(ctx, 4); err != nil {
+		t.Fatalf("Resize() while busy err = %v", err)
+	}
+	ctrl.EventPut(NewData(key, nil, record("c")), HashExec)
+	//新队列中其它key不受影响
+	other := ""
+	for i := 0; other == "" || other == key || ctrl.GetQueueIndexByHash(other) != ctrl.GetQueueIndexByHash(key); i++ {
+		other = fmt.Sprintf("other:%d", i)
+	}
+	ran := make(chan struct{})
+	ctrl.EventPut(NewData(other, nil, func(data any) error {
+		close(ran)
+		return nil
+	}), HashExec)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("event of a key that did not move was held back")
+	}
+	close(release)
+	ctrl.Drain(context.Background())
+	if got := fmt.Sprint(order); got != "[a b c]" {
+		t.Errorf("order = %s, want [a b c]", got)
+	}
+	ctrl.Stop(context.Background())
+}
+
+func TestCtrlResizeChainedPut(t *testing.T) {
+	ctrl := NewCtrl("resize", 2, 64, DefaultHash)
+	ctrl.Run()
+	key := movingKey(ctrl, 2, 4)
+	started, release := make(chan struct{}), make(chan struct{})
+	var chained int32
+	ctrl.EventPut(NewData(key, nil, func(data any) error {
+		close(started)
+		<-release
+		//下一次Resize等待这个key时, handle继续放入事件
+		ctrl.EventPut(NewData(key, nil, func(data any) error {
+			atomic.AddInt32(&chained, 1)
+			return nil
+		}), HashExec)
+		return nil
+	}), HashExec)
+	<-started
+	ctrl.Resize(context.Background(), 4)
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		done <- ctrl.Resize(ctx, 2)
+	}()
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Resize() err = %v, want nil", err)
+	}
+	ctrl.Drain(context.Background())
+	if n, c := ctrl.QueueCount(), atomic.LoadInt32(&chained); n != 2 || c != 1 {
+		t.Errorf("QueueCount() = %d with %d chained events run, want 2 with 1", n, c)
+	}
+	ctrl.Stop(context.Background())
+}
@@ -0,0 +1,112 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const defaultRetryMultiplier = 2
+
+// RetryPolicy ...
+type RetryPolicy struct {
+	MaxAttempts int                  //最大执行次数(含第一次), <=1 不重试
+	BaseDelay   time.Duration        //第一次重试前的等待时间
+	MaxDelay    time.Duration        //等待时间上限, 0 不限制
+	Multiplier  float64              //退避倍数, <=1 时取2
+	Jitter      float64              //抖动比例[0,1], 等待时间在 delay*(1±Jitter) 内随机
+	Retryable   func(err error) bool //错误分类, nil 表示除 Permanent 外都可重试
+}
+
+// DeadLetter receives the events whose handle still fails after the retries are exhausted
+type DeadLetter func(data *Data, err error, attempts int)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not retryable, whatever the RetryPolicy says
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent ...
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Backoff returns how long to wait after the given failed attempt (starting from 1)
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	if p == nil || p.BaseDelay <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 1 {
+		multiplier = defaultRetryMultiplier
+	}
+	delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	return time.Duration(delay)
+}
+
+// ShouldRetry ...
+func (p *RetryPolicy) ShouldRetry(err error, attempts int) bool {
+	if p == nil || err == nil || attempts >= p.MaxAttempts || IsPermanent(err) {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// retryPolicy ...
+func (c *Ctrl) retryPolicy(e *Data) *RetryPolicy {
+	if e.Retry != nil {
+		return e.Retry
+	}
+	return c.Retry
+}
+
+// handle 执行事件, 失败时在当前队列goroutine内退避重试, 保证同一队列内的顺序; ctx结束后不再重试
+func (c *Ctrl) handle(ctx context.Context, e *Data) error {
+	if e.Handle == nil && e.HandleCtx == nil {
+		return nil
+	}
+	policy := c.retryPolicy(e)
+	var err error
+	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if err == nil {
+				err = ctxErr
+			}
+			break
+		}
+		e.Attempts++
+		err = c.call(ctx, e)
+		if !policy.ShouldRetry(err, e.Attempts) || !sleepCtx(ctx, policy.Backoff(e.Attempts)) {
+			break
+		}
+	}
+	if err != nil && c.DeadLetter != nil && !canceledByCaller(e) {
+		c.DeadLetter(e, err, e.Attempts)
+	}
+	return err
+}
@@ -0,0 +1,106 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("test error")
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	wants := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}
+	for i, want := range wants {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", i+1, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(1); got < 5*time.Millisecond || got > 15*time.Millisecond {
+			t.Fatalf("Backoff(1) with jitter = %v, want in [5ms,15ms]", got)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool { return errors.Is(err, errTest) }}
+	cases := []struct {
+		name     string
+		err      error
+		attempts int
+		want     bool
+	}{
+		{"nil error", nil, 1, false},
+		{"retryable", errTest, 1, true},
+		{"exhausted", errTest, 3, false},
+		{"not retryable", errors.New("other"), 1, false},
+		{"permanent", Permanent(errTest), 1, false},
+	}
+	for _, tc := range cases {
+		if got := policy.ShouldRetry(tc.err, tc.attempts); got != tc.want {
+			t.Errorf("%s: ShouldRetry() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if (*RetryPolicy)(nil).ShouldRetry(errTest, 1) {
+		t.Errorf("nil policy ShouldRetry() = true, want false")
+	}
+}
+
+func TestCtrlRetryAndDeadLetter(t *testing.T) {
+	ctrl := NewCtrl("retry", 2, 16, DefaultHash)
+	ctrl.Retry = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	var mu sync.Mutex
+	var dead []int
+	ctrl.DeadLetter = func(data *Data, err error, attempts int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !errors.Is(err, errTest) || attempts != 3 {
+			t.Errorf("DeadLetter(%v, %v, %d), want err %v and 3 attempts", data.Data, err, attempts, errTest)
+		}
+		dead = append(dead, data.Data.(int))
+	}
+	ctrl.Run()
+
+	//同一个key: 失败重试期间后续事件不能越过
+	var order []int
+	for i := 0; i < 4; i++ {
+		failures := i % 2 * 5
+		ctrl.EventPut(NewData("account", i, func(data any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if failures > 0 {
+				failures--
+				return errTest
+			}
+			order = append(order, data.(int))
+			return nil
+		}), HashExec)
+	}
+	if _, err := ctrl.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() err = %v", err)
+	}
+	if fmt.Sprint(order) != "[0 2]" || fmt.Sprint(dead) != "[1 3]" {
+		t.Errorf("order = %v, dead = %v, want [0 2], [1 3]", order, dead)
+	}
+}
+
+func TestCtrlRetryDataOverride(t *testing.T) {
+	ctrl := NewCtrl("retry-override", 1, 16, DefaultHash)
+	ctrl.Retry = &RetryPolicy{MaxAttempts: 5}
+	ctrl.Run()
+	data := NewData("key", nil, func(data any) error {
+		return errTest
+	})
+	data.Retry = &RetryPolicy{MaxAttempts: 2}
+	ctrl.EventPut(data, HashExec)
+	ctrl.Stop(context.Background())
+	if data.Attempts != 2 {
+		t.Errorf("Attempts = %d, want 2", data.Attempts)
+	}
+}
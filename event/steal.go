@@ -0,0 +1,42 @@
+package event
+
+import "time"
+
+const stealPollPeriod = 5 * time.Millisecond
+
+// next 取下一个要执行的事件. 开启WorkStealing时, 自己的队列空闲就从其它忙碌队列的尾部偷非HashExec事件,
+// 没有可偷的事件时每stealPollPeriod再试一次
+func (c *Ctrl) next(q *queue) (*Data, bool) {
+	if !c.WorkStealing {
+		return q.pop()
+	}
+	for {
+		e, ok, timeout := q.popTimeout(stealPollPeriod)
+		if !timeout {
+			return e, ok
+		}
+		if e := c.steal(q); e != nil {
+			return e, true
+		}
+	}
+}
+
+// steal Resize切换队列时不偷, 不阻塞worker
+func (c *Ctrl) steal(thief *queue) *Data {
+	if thief.isPaused() || !c.queueMu.TryRLock() {
+		return nil
+	}
+	defer c.queueMu.RUnlock()
+	n := len(c.queues)
+	for i := 1; i < n; i++ {
+		victim := c.queues[(thief.index+i)%n]
+		if victim == nil || victim == thief {
+			continue
+		}
+		if e := victim.steal(); e != nil {
+			thief.adopt(e)
+			return e
+		}
+	}
+	return nil
+}
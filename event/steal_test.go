@@ -0,0 +1,54 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCtrlWorkStealing(t *testing.T) {
+	ctrl := NewCtrl("steal", 2, 16, DefaultHash)
+	ctrl.WorkStealing = true
+	ctrl.Run()
+	release := make(chan struct{})
+	ctrl.EventPut(NewData("", "slow", func(data any) error {
+		<-release
+		return nil
+	}), RRExec)
+
+	//找一个会路由到被阻塞队列0的key
+	key := ""
+	for i := 0; ctrl.GetQueueIndexByHash(key) != 0; i++ {
+		key = fmt.Sprintf("key:%d", i)
+	}
+	var keyedRan int64
+	ctrl.EventPut(NewData(key, nil, func(data any) error {
+		atomic.StoreInt64(&keyedRan, 1)
+		return nil
+	}), HashExec)
+
+	var handled int64
+	for i := 0; i < 6; i++ {
+		ctrl.EventPut(NewData("", i, func(data any) error {
+			atomic.AddInt64(&handled, 1)
+			return nil
+		}), RRExec)
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&handled) < 6 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt64(&handled); got != 6 {
+		t.Errorf("handled while queue 0 is blocked = %d, want 6", got)
+	}
+	if atomic.LoadInt64(&keyedRan) != 0 {
+		t.Errorf("HashExec event was stolen from its queue")
+	}
+	close(release)
+	ctrl.Stop(context.Background())
+	if atomic.LoadInt64(&keyedRan) != 1 {
+		t.Errorf("HashExec event did not run")
+	}
+}
@@ -0,0 +1,50 @@
+package event
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrExpired is the error of the events skipped because they waited longer than their TTL
+var ErrExpired = errors.New("event: expired before execution")
+
+// ExpireFunc receives the events skipped because they waited longer than their TTL
+type ExpireFunc func(data *Data, waited time.Duration)
+
+// WithTTL sets how long the event may wait in its queue, see Data.TTL
+func WithTTL(ttl time.Duration) DataOption {
+	return func(data *Data) {
+		data.TTL = ttl
+	}
+}
+
+// ttl ...
+func (c *Ctrl) ttl(e *Data) time.Duration {
+	if e.TTL > 0 {
+		return e.TTL
+	}
+	return c.TTL
+}
+
+// expire 事件出队时已超过TTL则跳过执行, 交给OnExpire; 重试之间不再检查
+func (c *Ctrl) expire(e *Data) bool {
+	ttl := c.ttl(e)
+	if ttl <= 0 {
+		return false
+	}
+	waited := time.Since(e.InQueueTime)
+	if waited <= ttl {
+		return false
+	}
+	atomic.AddInt64(&c.expired, 1)
+	if c.OnExpire != nil {
+		c.OnExpire(e, waited)
+	}
+	return true
+}
+
+// Expired returns how many events were skipped because their TTL passed while they waited
+func (c *Ctrl) Expired() int64 {
+	return atomic.LoadInt64(&c.expired)
+}
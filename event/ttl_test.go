@@ -0,0 +1,46 @@
+package event
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCtrlTTL(t *testing.T) {
+	ctrl, release := newBlockedCtrl(t, OverflowBlock, 16)
+	ctrl.TTL = 10 * time.Millisecond
+	var expired []any
+	ctrl.OnExpire = func(data *Data, waited time.Duration) {
+		if waited < ctrl.TTL {
+			t.Errorf("OnExpire() waited = %s, want > %s", waited, ctrl.TTL)
+		}
+		expired = append(expired, data.Data)
+	}
+	ctrl.DeadLetter = func(data *Data, err error, attempts int) {
+		t.Errorf("DeadLetter() called for %v with %v", data.Data, err)
+	}
+	var ran []any
+	handle := func(data any) error {
+		ran = append(ran, data)
+		return nil
+	}
+	ctrl.EventPut(NewData("", "stale", handle), RRExec)
+	ctrl.EventPut(NewData("", "long-lived", handle, WithTTL(time.Hour)), RRExec)
+	f, _ := EventCall(ctrl, "", "call", func(ctx context.Context, data any) (any, error) {
+		return handle(data), nil
+	}, RRExec)
+	time.Sleep(20 * time.Millisecond)
+	ctrl.EventPut(NewData("", "fresh", handle), RRExec)
+	close(release)
+	ctrl.Stop(context.Background())
+
+	if len(ran) != 2 || ran[0] != "long-lived" || ran[1] != "fresh" {
+		t.Errorf("ran %v, want [long-lived fresh]", ran)
+	}
+	if len(expired) != 2 || expired[0] != "stale" || ctrl.Expired() != 2 {
+		t.Errorf("expired %v (Expired() = %d), want [stale call]", expired, ctrl.Expired())
+	}
+	if _, err := f.Wait(context.Background()); err != ErrExpired {
+		t.Errorf("Wait() err = %v, want %v", err, ErrExpired)
+	}
+}
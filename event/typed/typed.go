@@ -0,0 +1,154 @@
+package typed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/matt-repository/golib/event"
+	"reflect"
+	"time"
+)
+
+// ErrPayloadType is returned, as a permanent error, when the payload of an event is not a T, e.g.
+// one replayed through a codec that decodes into another type or produced by a Merge
+var ErrPayloadType = errors.New("typed: payload type mismatch")
+
+// Handle ...
+type Handle[T any] func(data T) error
+
+// HandleCtx ...
+type HandleCtx[T any] func(ctx context.Context, data T) error
+
+// Data wraps an event.Data whose payload is always a T
+type Data[T any] struct {
+	*event.Data
+}
+
+// NewData ...
+func NewData[T any](key string, data T, handle Handle[T], opts ...event.DataOption) *Data[T] {
+	var h event.Handle
+	if handle != nil {
+		h = func(data any) error {
+			v, err := value[T](data)
+			if err != nil {
+				return err
+			}
+			return handle(v)
+		}
+	}
+	return &Data[T]{Data: event.NewData(key, data, h, opts...)}
+}
+
+// NewDataCtx ...
+func NewDataCtx[T any](key string, data T, handle HandleCtx[T], opts ...event.DataOption) *Data[T] {
+	var h event.HandleCtx
+	if handle != nil {
+		h = func(ctx context.Context, data any) error {
+			v, err := value[T](data)
+			if err != nil {
+				return err
+			}
+			return handle(ctx, v)
+		}
+	}
+	return &Data[T]{Data: event.NewDataCtx(key, data, h, opts...)}
+}
+
+// value 断言payload为T; T为接口或指针类型时nil取零值, 其它类型不匹配时返回ErrPayloadType
+func value[T any](data any) (T, error) {
+	v, ok := data.(T)
+	if ok || data == nil {
+		return v, nil
+	}
+	return v, event.Permanent(fmt.Errorf("%w: %T is not %s", ErrPayloadType, data, reflect.TypeOf((*T)(nil)).Elem()))
+}
+
+// Value returns the payload, the zero value when it is not a T
+func (d *Data[T]) Value() T {
+	v, _ := d.Data.Data.(T)
+	return v
+}
+
+// Ctrl is an event.Ctrl that only accepts *Data[T]
+type Ctrl[T any] struct {
+	ctrl *event.Ctrl
+}
+
+// NewCtrl ...
+func NewCtrl[T any](name string, queueCount int, chanBufferSize int64, hash event.Hash) *Ctrl[T] {
+	return &Ctrl[T]{ctrl: event.NewCtrl(name, queueCount, chanBufferSize, hash)}
+}
+
+// Unwrap returns the underlying event.Ctrl, to set its options before Run or read its state.
+// Events put through it directly are not checked to carry a T.
+func (c *Ctrl[T]) Unwrap() *event.Ctrl {
+	return c.ctrl
+}
+
+// Run ...
+func (c *Ctrl[T]) Run() {
+	c.ctrl.Run()
+}
+
+// Stop see event.Ctrl.Stop
+func (c *Ctrl[T]) Stop(ctx context.Context) (int, error) {
+	return c.ctrl.Stop(ctx)
+}
+
+// Drain see event.Ctrl.Drain
+func (c *Ctrl[T]) Drain(ctx context.Context) error {
+	return c.ctrl.Drain(ctx)
+}
+
+// Pending see event.Ctrl.Pending
+func (c *Ctrl[T]) Pending() int {
+	return c.ctrl.Pending()
+}
+
+// EventPut ...
+func (c *Ctrl[T]) EventPut(data *Data[T], execType event.ExecType) bool {
+	if data == nil {
+		return false
+	}
+	return c.ctrl.EventPut(data.Data, execType)
+}
+
+// TryPut ...
+func (c *Ctrl[T]) TryPut(data *Data[T], execType event.ExecType) error {
+	if data == nil {
+		return event.ErrNilData
+	}
+	return c.ctrl.TryPut(data.Data, execType)
+}
+
+// PutWithTimeout ...
+func (c *Ctrl[T]) PutWithTimeout(ctx context.Context, data *Data[T], execType event.ExecType) error {
+	if data == nil {
+		return event.ErrNilData
+	}
+	return c.ctrl.PutWithTimeout(ctx, data.Data, execType)
+}
+
+// EventPutAfter ...
+func (c *Ctrl[T]) EventPutAfter(data *Data[T], delay time.Duration, execType event.ExecType) (*event.Scheduled, error) {
+	if data == nil {
+		return nil, event.ErrNilData
+	}
+	return c.ctrl.EventPutAfter(data.Data, delay, execType)
+}
+
+// EventPutAt ...
+func (c *Ctrl[T]) EventPutAt(data *Data[T], at time.Time, execType event.ExecType) (*event.Scheduled, error) {
+	if data == nil {
+		return nil, event.ErrNilData
+	}
+	return c.ctrl.EventPutAt(data.Data, at, execType)
+}
+
+// EventPutWithCancel ...
+func (c *Ctrl[T]) EventPutWithCancel(data *Data[T], execType event.ExecType) (event.CancelFunc, error) {
+	if data == nil {
+		return nil, event.ErrNilData
+	}
+	return c.ctrl.EventPutWithCancel(data.Data, execType)
+}
@@ -0,0 +1,97 @@
+package typed
+
+import (
+	"context"
+	"errors"
+	"github.com/matt-repository/golib/event"
+	"sync"
+	"testing"
+)
+
+var errTest = errors.New("test")
+
+type order struct {
+	ID     string
+	Amount int
+}
+
+func TestCtrl(t *testing.T) {
+	ctrl := NewCtrl[order]("typed", 2, 16, nil)
+	ctrl.Run()
+	var mu sync.Mutex
+	total := map[string]int{}
+	handle := func(o order) error {
+		mu.Lock()
+		defer mu.Unlock()
+		total[o.ID] += o.Amount
+		return nil
+	}
+	for i := 1; i <= 4; i++ {
+		o := order{ID: "a", Amount: i}
+		if i%2 == 0 {
+			o.ID = "b"
+		}
+		data := NewData(o.ID, o, handle)
+		if data.Value() != o {
+			t.Fatalf("Value() = %v, want %v", data.Value(), o)
+		}
+		if err := ctrl.TryPut(data, event.HashExec); err != nil {
+			t.Fatalf("TryPut() err = %v", err)
+		}
+	}
+	if ctrl.EventPut(nil, event.HashExec) {
+		t.Errorf("EventPut(nil) = true, want false")
+	}
+	ctrl.Stop(context.Background())
+	if total["a"] != 4 || total["b"] != 6 {
+		t.Errorf("total = %v, want a:4 b:6", total)
+	}
+}
+
+func TestCtrlCtx(t *testing.T) {
+	ctrl := NewCtrl[error]("typed", 1, 16, nil)
+	ctrl.Unwrap().Retry = &event.RetryPolicy{MaxAttempts: 1}
+	ctrl.Run()
+	var got []error
+	handle := func(ctx context.Context, err error) error {
+		got = append(got, err)
+		return nil
+	}
+	data := NewDataCtx[error]("k", nil, handle)
+	if data.Value() != nil {
+		t.Errorf("Value() = %v, want nil", data.Value())
+	}
+	ctrl.EventPut(data, event.HashExec)
+	cancel, err := ctrl.EventPutWithCancel(NewDataCtx[error]("k", errTest, handle), event.HashExec)
+	if err != nil || cancel == nil {
+		t.Fatalf("EventPutWithCancel() err = %v", err)
+	}
+	if _, err := ctrl.EventPutAfter(nil, 0, event.HashExec); err != event.ErrNilData {
+		t.Errorf("EventPutAfter(nil) err = %v, want %v", err, event.ErrNilData)
+	}
+	ctrl.Stop(context.Background())
+	if len(got) != 2 || got[0] != nil || got[1] != errTest {
+		t.Errorf("handled %v, want [<nil> %v]", got, errTest)
+	}
+}
+
+func TestCtrlPayloadType(t *testing.T) {
+	ctrl := NewCtrl[order]("typed", 1, 16, nil)
+	var dead []error
+	ctrl.Unwrap().DeadLetter = func(data *event.Data, err error, attempts int) {
+		dead = append(dead, err)
+	}
+	ctrl.Run()
+	handled := 0
+	data := NewData("a", order{ID: "a"}, func(o order) error {
+		handled++
+		return nil
+	})
+	//例如用JSONCodec[any]重放的payload
+	data.Data.Data = map[string]any{"ID": "a"}
+	ctrl.EventPut(data, event.HashExec)
+	ctrl.Stop(context.Background())
+	if handled != 0 || len(dead) != 1 || !errors.Is(dead[0], ErrPayloadType) {
+		t.Errorf("handled %d, dead letters %v, want 0 and %v", handled, dead, ErrPayloadType)
+	}
+}
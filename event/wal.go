@@ -0,0 +1,399 @@
+package event
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultSegmentSize = 64 << 20
+	walHeaderSize      = 8
+	walSuffix          = ".wal"
+)
+
+const (
+	walPut byte = iota + 1 //事件入队
+	walAck                 //事件执行完成或被丢弃
+)
+
+var ErrNoResolve = errors.New("event: WALOptions.Resolve is required")
+
+// Codec serializes Data.Data for the write-ahead log
+type Codec interface {
+	Marshal(data any) ([]byte, error)
+	Unmarshal(b []byte) (any, error)
+}
+
+// JSONCodec decodes payloads as T
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Marshal(data any) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func (JSONCodec[T]) Unmarshal(b []byte) (any, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// WALOptions ...
+type WALOptions struct {
+	SegmentSize int64                   //单个段文件大小上限, <=0 取64MB
+	NoSync      bool                    //写入后不fsync, 进程崩溃不丢但机器掉电可能丢
+	Codec       Codec                   //Data.Data的编解码, nil 使用 JSONCodec[any]
+	Resolve     func(data *Data) Handle //重放时为事件找回Handle, 必填
+}
+
+type segment struct {
+	id      uint64 //不大于段内第一个序号, 也是文件名
+	path    string
+	unacked int
+}
+
+// WAL is a segmented write-ahead log for a Ctrl. EventPut appends the event before it is queued and
+// the event is acknowledged once its handle finished, was dead-lettered or dropped. Events still
+// unacknowledged when the process stops, including the ones abandoned by Stop, are replayed into
+// their queue by the next Ctrl.Run, so delivery is at least once.
+type WAL struct {
+	dir  string
+	opts WALOptions
+
+	mu        sync.Mutex
+	seq       uint64
+	file      *os.File
+	size      int64
+	segments  []*segment //按id升序, 最后一个是当前写入的段
+	unacked   map[uint64]*segment
+	recovered []*Data
+}
+
+// OpenWAL reads the log in dir, keeps the unacknowledged events for replay and starts a new segment
+func OpenWAL(dir string, opts WALOptions) (*WAL, error) {
+	if opts.Resolve == nil {
+		return nil, ErrNoResolve
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec[any]{}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &WAL{
+		dir:     dir,
+		opts:    opts,
+		unacked: make(map[uint64]*segment),
+	}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+	w.compact()
+	return w, nil
+}
+
+// load 按顺序读取所有段, 计算未确认的事件
+func (w *WAL) load() error {
+	names, err := filepath.Glob(filepath.Join(w.dir, "*"+walSuffix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), walSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, &segment{id: id, path: name})
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i].id < w.segments[j].id })
+
+	pending := make(map[uint64]*Data)
+	for _, seg := range w.segments {
+		err := readSegment(seg.path, w.opts.Codec, func(typ byte, seq uint64, e *Data) {
+			if seq > w.seq {
+				w.seq = seq
+			}
+			switch typ {
+			case walPut:
+				pending[seq] = e
+				w.unacked[seq] = seg
+				seg.unacked++
+			case walAck:
+				delete(pending, seq)
+				if s, ok := w.unacked[seq]; ok {
+					s.unacked--
+					delete(w.unacked, seq)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range pending {
+		e.Handle = w.opts.Resolve(e)
+		w.recovered = append(w.recovered, e)
+	}
+	sort.Slice(w.recovered, func(i, j int) bool { return w.recovered[i].seq < w.recovered[j].seq })
+	return nil
+}
+
+// readSegment 读到文件尾或第一条损坏(写了一半)的记录为止
+func readSegment(path string, codec Codec, f func(typ byte, seq uint64, e *Data)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	header := make([]byte, walHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(header))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			return nil
+		}
+		typ, seq, e, err := decodeRecord(payload, codec)
+		if err != nil {
+			return fmt.Errorf("event: wal %s seq %d: %w", path, seq, err)
+		}
+		f(typ, seq, e)
+	}
+}
+
+func encodeRecord(typ byte, e *Data, codec Codec) ([]byte, error) {
+	buf := make([]byte, walHeaderSize, walHeaderSize+64)
+	buf = append(buf, typ)
+	buf = appendUvarint(buf, e.seq)
+	if typ == walPut {
+		data, err := codec.Marshal(e.Data)
+		if err != nil {
+			return nil, err
+		}
+		buf = appendVarint(buf, int64(e.execType))
+		buf = appendVarint(buf, int64(e.QueueIndex))
+		buf = appendVarint(buf, int64(e.Priority))
+		buf = appendUvarint(buf, uint64(len(e.Key)))
+		buf = append(buf, e.Key...)
+		buf = append(buf, data...)
+	}
+	payload := buf[walHeaderSize:]
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(payload))
+	return buf, nil
+}
+
+// appendUvarint binary.AppendUvarint 需要go1.19
+func appendUvarint(buf []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], x)]...)
+}
+
+func appendVarint(buf []byte, x int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], x)]...)
+}
+
+var errBadRecord = errors.New("bad record")
+
+func decodeRecord(payload []byte, codec Codec) (byte, uint64, *Data, error) {
+	if len(payload) == 0 {
+		return 0, 0, nil, errBadRecord
+	}
+	typ, b := payload[0], payload[1:]
+	seq, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, nil, errBadRecord
+	}
+	b = b[n:]
+	if typ != walPut {
+		return typ, seq, nil, nil
+	}
+	var fields [3]int64
+	for i := range fields {
+		if fields[i], n = binary.Varint(b); n <= 0 {
+			return 0, seq, nil, errBadRecord
+		}
+		b = b[n:]
+	}
+	keyLen, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < keyLen {
+		return 0, seq, nil, errBadRecord
+	}
+	b = b[n:]
+	data, err := codec.Unmarshal(b[keyLen:])
+	if err != nil {
+		return 0, seq, nil, err
+	}
+	e := &Data{
+		Key:        string(b[:keyLen]),
+		QueueIndex: int(fields[1]),
+		Data:       data,
+		Priority:   Priority(fields[2]),
+		execType:   ExecType(fields[0]),
+		seq:        seq,
+	}
+	return typ, seq, e, nil
+}
+
+// rotate must be called with w.mu held or before the WAL is shared
+func (w *WAL) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+	}
+	//最后一段为空或只有确认记录时w.seq没有越过它的id, 新段的id要大于所有已有的段
+	id := w.seq + 1
+	if n := len(w.segments); n > 0 && w.segments[n-1].id >= id {
+		id = w.segments[n-1].id + 1
+	}
+	seg := &segment{id: id}
+	seg.path = filepath.Join(w.dir, fmt.Sprintf("%020d%s", seg.id, walSuffix))
+	file, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w.file, w.size = file, 0
+	w.segments = append(w.segments, seg)
+	return nil
+}
+
+// compact 删除前缀中所有事件都已确认的段. 只删前缀, 保证被删段中的确认记录对应的事件也在被删段中
+func (w *WAL) compact() {
+	for len(w.segments) > 1 && w.segments[0].unacked == 0 {
+		os.Remove(w.segments[0].path)
+		w.segments = w.segments[1:]
+	}
+}
+
+// write must be called with w.mu held
+func (w *WAL) write(typ byte, e *Data) error {
+	if w.file == nil {
+		return ErrClosed
+	}
+	buf, err := encodeRecord(typ, e, w.opts.Codec)
+	if err != nil {
+		return err
+	}
+	if w.size > 0 && w.size+int64(len(buf)) > w.opts.SegmentSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := w.file.Write(buf); err != nil {
+		return err
+	}
+	w.size += int64(len(buf))
+	if w.opts.NoSync {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// append 记录入队事件并为其分配序号
+func (w *WAL) append(e *Data) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	e.seq = w.seq
+	if err := w.write(walPut, e); err != nil {
+		e.seq = 0
+		return err
+	}
+	seg := w.segments[len(w.segments)-1]
+	seg.unacked++
+	w.unacked[e.seq] = seg
+	return nil
+}
+
+// relog 把合并后的事件记为新的一条并确认其原来的记录, 重放时得到合并后的值
+func (w *WAL) relog(e *Data) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	prev := *e
+	w.seq++
+	e.seq = w.seq
+	if err := w.write(walPut, e); err != nil {
+		e.seq = prev.seq
+		return err
+	}
+	seg := w.segments[len(w.segments)-1]
+	seg.unacked++
+	w.unacked[e.seq] = seg
+	return w.ackLocked(&prev)
+}
+
+// ack 记录事件已处理完
+func (w *WAL) ack(e *Data) error {
+	if e.seq == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ackLocked(e)
+}
+
+// ackLocked must be called with w.mu held
+func (w *WAL) ackLocked(e *Data) error {
+	seg, ok := w.unacked[e.seq]
+	if !ok {
+		return nil
+	}
+	if err := w.write(walAck, e); err != nil {
+		return err
+	}
+	delete(w.unacked, e.seq)
+	seg.unacked--
+	w.compact()
+	return nil
+}
+
+// Unacked returns the number of logged events not acknowledged yet
+func (w *WAL) Unacked() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.unacked)
+}
+
+// recover 取出待重放的事件, 只返回一次
+func (w *WAL) recover() []*Data {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	recovered := w.recovered
+	w.recovered = nil
+	return recovered
+}
+
+// Close ...
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,306 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWALReplay(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var replayed []string
+	opts := WALOptions{
+		Codec: JSONCodec[string]{},
+		Resolve: func(data *Data) Handle {
+			return func(data any) error {
+				mu.Lock()
+				defer mu.Unlock()
+				replayed = append(replayed, data.(string))
+				return nil
+			}
+		},
+	}
+	wal, err := OpenWAL(dir, opts)
+	if err != nil {
+		t.Fatalf("OpenWAL() err = %v", err)
+	}
+	ctrl := NewCtrl("wal", 1, 16, DefaultHash)
+	ctrl.WAL = wal
+	ctrl.Run()
+	release := make(chan struct{})
+	for i := 0; i < 6; i++ {
+		ctrl.EventPut(NewData("key", fmt.Sprintf("v%d", i), func(data any) error {
+			<-release
+			return nil
+		}), HashExec)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if abandoned, _ := ctrl.Stop(ctx); abandoned != 5 {
+		t.Fatalf("Stop() abandoned = %d, want 5", abandoned)
+	}
+	close(release)
+	ctrl.Drain(context.Background())
+	if got := wal.Unacked(); got != 5 {
+		t.Fatalf("Unacked() = %d, want 5", got)
+	}
+	wal.Close()
+
+	//模拟崩溃时写了一半的记录
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+walSuffix))
+	f, _ := os.OpenFile(names[len(names)-1], os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{0xff, 0, 0, 0, 1, 2})
+	f.Close()
+
+	wal, err = OpenWAL(dir, opts)
+	if err != nil {
+		t.Fatalf("reopen OpenWAL() err = %v", err)
+	}
+	defer wal.Close()
+	ctrl = NewCtrl("wal", 1, 16, DefaultHash)
+	ctrl.WAL = wal
+	ctrl.Run()
+	ctrl.Stop(context.Background())
+	if got, want := fmt.Sprint(replayed), "[v1 v2 v3 v4 v5]"; got != want {
+		t.Errorf("replayed = %s, want %s", got, want)
+	}
+	if got := wal.Unacked(); got != 0 {
+		t.Errorf("Unacked() after replay = %d, want 0", got)
+	}
+}
+
+func TestWALCompact(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := OpenWAL(dir, WALOptions{
+		SegmentSize: 256,
+		NoSync:      true,
+		Resolve:     func(data *Data) Handle { return nil },
+	})
+	if err != nil {
+		t.Fatalf("OpenWAL() err = %v", err)
+	}
+	defer wal.Close()
+	ctrl := NewCtrl("wal-compact", 1, 16, DefaultHash)
+	ctrl.WAL = wal
+	ctrl.Run()
+	for i := 0; i < 100; i++ {
+		ctrl.EventPut(NewData("", i, func(data any) error { return nil }), RRExec)
+	}
+	ctrl.Stop(context.Background())
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+walSuffix))
+	if len(names) > 2 || wal.Unacked() != 0 {
+		t.Errorf("segments = %d, unacked = %d, want at most 2 segments and 0 unacked", len(names), wal.Unacked())
+	}
+	if _, err := OpenWAL(dir, WALOptions{}); err != ErrNoResolve {
+		t.Errorf("OpenWAL() without Resolve err = %v, want %v", err, ErrNoResolve)
+	}
+}
+
+type queueRecorder struct {
+	NopObserver
+	mu     sync.Mutex
+	queues map[any]int
+}
+
+func (r *queueRecorder) OnExecStart(name string, data *Data, wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queues[data.Data] = data.QueueIndex
+}
+
+func TestWALReplayReroute(t *testing.T) {
+	dir := t.TempDir()
+	opts := WALOptions{
+		Codec:   JSONCodec[string]{},
+		Resolve: func(data *Data) Handle { return func(data any) error { return nil } },
+	}
+	wal, _ := OpenWAL(dir, opts)
+	ctrl := NewCtrl("wal", 1, 16, DefaultHash)
+	ctrl.WAL = wal
+	ctrl.Run()
+	started, release := make(chan struct{}), make(chan struct{})
+	ctrl.EventPut(NewData("a", "a", func(data any) error {
+		close(started)
+		<-release
+		return nil
+	}), HashExec)
+	<-started
+	for _, key := range []string{"b", "c", "d"} {
+		ctrl.EventPut(NewData(key, key, nil), HashExec)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ctrl.Stop(ctx)
+	close(release)
+	ctrl.Drain(context.Background())
+	wal.Close()
+
+	//重启时队列数变多, 恢复的HashExec事件按新的队列数路由
+	wal, _ = OpenWAL(dir, opts)
+	defer wal.Close()
+	recorder := &queueRecorder{queues: map[any]int{}}
+	ctrl = NewCtrl("wal", 4, 16, DefaultHash)
+	ctrl.WAL = wal
+	ctrl.Observer = recorder
+	ctrl.Run()
+	ctrl.Stop(context.Background())
+	if len(recorder.queues) != 3 {
+		t.Fatalf("replayed %v, want b c d", recorder.queues)
+	}
+	for key, queue := range recorder.queues {
+		if want := ctrl.Hash(key.(string)) % 4; queue != want {
+			t.Errorf("key %s replayed on queue %d, want %d", key, queue, want)
+		}
+	}
+}
+
+func TestWALCoalesceMerge(t *testing.T) {
+	dir := t.TempDir()
+	var replayed []int
+	opts := WALOptions{
+		Codec: JSONCodec[int]{},
+		Resolve: func(data *Data) Handle {
+			return func(data any) error {
+				replayed = append(replayed, data.(int))
+				return nil
+			}
+		},
+	}
+	wal, _ := OpenWAL(dir, opts)
+	ctrl := NewCtrl("wal", 1, 16, DefaultHash)
+	ctrl.WAL = wal
+	ctrl.Coalesce = true
+	ctrl.Merge = func(pending, incoming *Data) *Data {
+		pending.Data = pending.Data.(int) + incoming.Data.(int)
+		return pending
+	}
+	ctrl.Run()
+	started, release := make(chan struct{}), make(chan struct{})
+	ctrl.EventPut(NewData("block", 0, func(data any) error {
+		close(started)
+		<-release
+		return nil
+	}), HashExec)
+	<-started
+	for i := 1; i <= 4; i++ {
+		ctrl.EventPut(NewData("counter", i, nil), HashExec)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ctrl.Stop(ctx)
+	close(release)
+	ctrl.Drain(context.Background())
+	if got := wal.Unacked(); got != 1 {
+		t.Fatalf("Unacked() = %d, want 1", got)
+	}
+	wal.Close()
+
+	//重放得到合并后的值
+	wal, _ = OpenWAL(dir, opts)
+	defer wal.Close()
+	ctrl = NewCtrl("wal", 1, 16, DefaultHash)
+	ctrl.WAL = wal
+	ctrl.Run()
+	ctrl.Stop(context.Background())
+	if got, want := fmt.Sprint(replayed), "[10]"; got != want {
+		t.Errorf("replayed = %s, want %s", got, want)
+	}
+}
+
+func TestWALReopen(t *testing.T) {
+	opts := WALOptions{
+		Codec:   JSONCodec[string]{},
+		Resolve: func(data *Data) Handle { return func(data any) error { return nil } },
+	}
+	reopen := func(w *WAL, dir string) *WAL {
+		if w != nil {
+			w.Close()
+		}
+		w, err := OpenWAL(dir, opts)
+		if err != nil {
+			t.Fatalf("OpenWAL() err = %v", err)
+		}
+		return w
+	}
+	recovered := func(w *WAL) string {
+		var values []any
+		for _, e := range w.recover() {
+			values = append(values, e.Data)
+		}
+		return fmt.Sprint(values)
+	}
+
+	//最后一段为空
+	dir := t.TempDir()
+	w := reopen(reopen(nil, dir), dir)
+	w.append(&Data{Data: "a"})
+	w = reopen(w, dir)
+	if got := recovered(w); got != "[a]" {
+		t.Errorf("recovered after an empty segment = %s, want [a]", got)
+	}
+	w.Close()
+
+	//最后一段只有确认记录
+	dir = t.TempDir()
+	w = reopen(nil, dir)
+	w.append(&Data{Data: "a"})
+	w.append(&Data{Data: "b"})
+	w = reopen(w, dir)
+	w.ack(w.recover()[0])
+	w = reopen(w, dir)
+	w.append(&Data{Data: "c"})
+	w = reopen(w, dir)
+	if got := recovered(w); got != "[b c]" {
+		t.Errorf("recovered after an acks-only segment = %s, want [b c]", got)
+	}
+	w.Close()
+}
+
+func TestWALReplayFull(t *testing.T) {
+	dir := t.TempDir()
+	var ctrl *Ctrl
+	var mu sync.Mutex
+	var replayed []any
+	opts := WALOptions{
+		Codec: JSONCodec[string]{},
+		Resolve: func(data *Data) Handle {
+			return func(data any) error {
+				<-ctrl.Done()
+				mu.Lock()
+				defer mu.Unlock()
+				replayed = append(replayed, data)
+				return nil
+			}
+		},
+	}
+	wal, _ := OpenWAL(dir, opts)
+	for i := 0; i < 4; i++ {
+		wal.append(&Data{Data: fmt.Sprintf("v%d", i)})
+	}
+	wal.Close()
+
+	//恢复的事件比队列容量多, handle在Run返回前就需要拿putMu
+	wal, _ = OpenWAL(dir, opts)
+	defer wal.Close()
+	ctrl = NewCtrl("wal", 1, 1, DefaultHash)
+	ctrl.WAL = wal
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() blocked replaying more events than the queue holds")
+	}
+	ctrl.Stop(context.Background())
+	if got, want := fmt.Sprint(replayed), "[v0 v1 v2 v3]"; got != want {
+		t.Errorf("replayed = %s, want %s", got, want)
+	}
+}